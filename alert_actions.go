@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"alertmanager/models"
+	"alertmanager/utilities"
+)
+
+// applyRuleActions performs the actions of a matched alert rule in order and
+// returns a description of each change made. Values are rendered against the
+// alert as changed by the preceding actions. An action that fails is logged
+// and skipped, the remaining actions still run.
+func applyRuleActions(alert *models.DbAlert, actions []models.RuleAction) []string {
+	var changes []string
+	for _, action := range actions {
+		change, err := applyRuleAction(alert, action)
+		if err != nil {
+			fmt.Printf("ERROR : rule action %s failed: %v\n", action.Type, err)
+			continue
+		}
+		if change != "" {
+			changes = append(changes, change)
+		}
+	}
+	return changes
+}
+
+func applyRuleAction(alert *models.DbAlert, action models.RuleAction) (string, error) {
+	value, err := utilities.RenderTemplate(action.Value, alert)
+	if err != nil {
+		return "", err
+	}
+
+	switch action.Type {
+	case models.ActionSet:
+		field := reflect.ValueOf(alert).Elem().FieldByName(action.Field)
+		if !field.IsValid() || !field.CanSet() || field.Kind() != reflect.String {
+			return "", fmt.Errorf("field %s is not settable", action.Field)
+		}
+		previous := field.String()
+		field.SetString(value)
+		return fmt.Sprintf("set %s: %q -> %q", action.Field, previous, value), nil
+
+	case models.ActionSetTag:
+		if alert.AdditionalDetails == nil {
+			alert.AdditionalDetails = make(map[string]interface{})
+		}
+		alert.AdditionalDetails[action.Tag] = value
+		return fmt.Sprintf("set tag %s = %q", action.Tag, value), nil
+
+	case models.ActionRemoveTag:
+		if _, ok := alert.AdditionalDetails[action.Tag]; !ok {
+			return "", nil
+		}
+		delete(alert.AdditionalDetails, action.Tag)
+		return fmt.Sprintf("remove tag %s", action.Tag), nil
+
+	case models.ActionSetPriority:
+		// A template may render to anything, so the result is checked again.
+		if !utilities.IsPriority(value) {
+			return "", fmt.Errorf("%q is not a priority", value)
+		}
+		previous := alert.AlertPriority
+		alert.AlertPriority = utilities.IntToPriority(utilities.PriorityToInt(value))
+		return fmt.Sprintf("set AlertPriority: %q -> %q", previous, alert.AlertPriority), nil
+
+	case models.ActionRaisePriority, models.ActionLowerPriority:
+		steps := action.Steps
+		if steps == 0 {
+			steps = 1
+		}
+		if action.Type == models.ActionRaisePriority {
+			steps = -steps
+		}
+		previous := alert.AlertPriority
+		alert.AlertPriority = utilities.ShiftPriority(previous, steps)
+		return fmt.Sprintf("%s: %q -> %q", action.Type, previous, alert.AlertPriority), nil
+
+	case models.ActionAppendNote:
+		if strings.TrimSpace(value) == "" {
+			return "", nil
+		}
+		if alert.AlertNotes == "" {
+			alert.AlertNotes = value
+		} else {
+			alert.AlertNotes += "\n" + value
+		}
+		return fmt.Sprintf("append note %q", value), nil
+
+	case models.ActionDrop:
+		if alert.AlertDropped == models.AlertDiscarded {
+			return "", nil
+		}
+		alert.AlertDropped = models.AlertDroppedYes
+		return "mark alert dropped (stored, not grouped or notified)", nil
+
+	case models.ActionDiscard:
+		alert.AlertDropped = models.AlertDiscarded
+		return "discard alert (not stored)", nil
+	}
+	return "", fmt.Errorf("unknown action type %q", action.Type)
+}
@@ -0,0 +1,422 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"alertmanager/models"
+	"alertmanager/ruleengine"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	backtestDefaultLimit = 10000
+	backtestMaxLimit     = 100000
+	backtestSamples      = 20
+	// backtestJobsKept is how many finished jobs stay available in memory.
+	backtestJobsKept = 50
+)
+
+// backtestMaxRunning is how many backtests may run at the same time.
+var backtestMaxRunning = envInt("BACKTEST_MAX_RUNNING", 2)
+
+// BacktestRequest replays a rule over stored alerts. The rule is given as in
+// a rule test (ruleId or an inline rule); the alerts are selected like the
+// export endpoint does (from, to, status, service, tag "key:value").
+type BacktestRequest struct {
+	RuleType string          `json:"ruleType"` // alert, tag or notify
+	RuleId   string          `json:"ruleId"`
+	Rule     json.RawMessage `json:"rule"`
+	From     string          `json:"from"`
+	To       string          `json:"to"`
+	Status   string          `json:"status"`
+	Service  string          `json:"service"`
+	Tags     []string        `json:"tags"`
+	Archive  string          `json:"archive"`
+	Limit    int64           `json:"limit"`
+}
+
+type BacktestSample struct {
+	AlertID  string   `json:"alert_id"`
+	Entity   string   `json:"entity"`
+	Summary  string   `json:"summary"`
+	Priority string   `json:"priority"`
+	Actions  []string `json:"actions"`
+}
+
+// BacktestReport summarises what the rule would have done.
+type BacktestReport struct {
+	Scanned         int64            `json:"scanned"`
+	Matched         int64            `json:"matched"`
+	Errors          int64            `json:"errors"`
+	FieldChanges    map[string]int64 `json:"field_changes"`
+	PriorityChanges map[string]int64 `json:"priority_changes"`
+	Dropped         int64            `json:"dropped"`
+	Discarded       int64            `json:"discarded"`
+	Notifications   map[string]int64 `json:"notifications"`
+	Samples         []BacktestSample `json:"samples"`
+	FirstErrors     []string         `json:"first_errors"`
+}
+
+type BacktestJob struct {
+	ID         string          `json:"id"`
+	Status     string          `json:"status"` // running, completed, failed, cancelled
+	RuleType   string          `json:"ruleType"`
+	RuleName   string          `json:"ruleName"`
+	Request    BacktestRequest `json:"request"`
+	StartedAt  time.Time       `json:"started_at"`
+	FinishedAt *time.Time      `json:"finished_at,omitempty"`
+	Error      string          `json:"error,omitempty"`
+	Report     *BacktestReport `json:"report"`
+
+	cancel context.CancelFunc
+}
+
+var backtestJobsMutex sync.Mutex
+var backtestJobs = make(map[string]*BacktestJob)
+var backtestJobOrder []string
+
+// BacktestHandler starts a backtest job (POST) or lists recent jobs (GET).
+// Backtests only read alerts; rule actions are applied to in-memory copies
+// and notifications are only described, never sent. Relative date and
+// schedule conditions are evaluated at each alert's first occurrence.
+// At most BACKTEST_MAX_RUNNING jobs run at once, further POSTs get 429.
+func BacktestHandler(w http.ResponseWriter, r *http.Request, mongoClient *mongo.Client) {
+	switch r.Method {
+	case http.MethodGet:
+		backtestJobsMutex.Lock()
+		jobs := make([]BacktestJob, 0, len(backtestJobOrder))
+		for i := len(backtestJobOrder) - 1; i >= 0; i-- {
+			job := *backtestJobs[backtestJobOrder[i]]
+			job.Report = nil
+			jobs = append(jobs, job)
+		}
+		backtestJobsMutex.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(jobs)
+
+	case http.MethodPost:
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "Error reading request body", http.StatusInternalServerError)
+			return
+		}
+		var request BacktestRequest
+		if err := json.Unmarshal(body, &request); err != nil {
+			http.Error(w, "Error parsing JSON", http.StatusBadRequest)
+			return
+		}
+
+		// Fail fast on bad rules and filters rather than in the job.
+		rule, err := prepareTestRule(mongoClient, RuleTestRequest{
+			RuleType: request.RuleType,
+			RuleId:   request.RuleId,
+			Rule:     request.Rule,
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		filter, err := backtestFilter(request)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		collections, err := alertQueryCollections(mongoClient, request.Archive)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if request.Limit <= 0 {
+			request.Limit = backtestDefaultLimit
+		}
+		if request.Limit > backtestMaxLimit {
+			request.Limit = backtestMaxLimit
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		job := &BacktestJob{
+			ID:        primitive.NewObjectID().Hex(),
+			Status:    "running",
+			RuleType:  request.RuleType,
+			RuleName:  rule.name,
+			Request:   request,
+			StartedAt: time.Now(),
+			cancel:    cancel,
+		}
+		if !addBacktestJob(job) {
+			cancel()
+			http.Error(w, fmt.Sprintf("Too many backtests running, at most %d at a time", backtestMaxRunning), http.StatusTooManyRequests)
+			return
+		}
+		go runBacktest(ctx, job, rule, collections, filter, request.Limit)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(job)
+
+	default:
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+	}
+}
+
+// BacktestJobHandler returns one backtest job with its report, which is
+// partial while the job is still running (GET), or cancels a running job
+// (DELETE).
+func BacktestJobHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodDelete {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	backtestJobsMutex.Lock()
+	job, ok := backtestJobs[r.PathValue("id")]
+	if ok && r.Method == http.MethodDelete {
+		job.cancel()
+	}
+	var snapshot []byte
+	if ok {
+		snapshot, _ = json.Marshal(job)
+	}
+	backtestJobsMutex.Unlock()
+
+	if !ok {
+		http.Error(w, "Backtest job not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(snapshot)
+}
+
+// addBacktestJob registers a new job, or returns false if the maximum
+// number of jobs is already running. Evicted jobs are cancelled so they do
+// not keep running unseen.
+func addBacktestJob(job *BacktestJob) bool {
+	backtestJobsMutex.Lock()
+	defer backtestJobsMutex.Unlock()
+
+	running := 0
+	for _, existing := range backtestJobs {
+		if existing.Status == "running" {
+			running++
+		}
+	}
+	if running >= backtestMaxRunning {
+		return false
+	}
+
+	backtestJobs[job.ID] = job
+	backtestJobOrder = append(backtestJobOrder, job.ID)
+	for len(backtestJobOrder) > backtestJobsKept {
+		backtestJobs[backtestJobOrder[0]].cancel()
+		delete(backtestJobs, backtestJobOrder[0])
+		backtestJobOrder = backtestJobOrder[1:]
+	}
+	return true
+}
+
+func backtestFilter(request BacktestRequest) (bson.M, error) {
+	params := url.Values{}
+	params.Set("from", request.From)
+	params.Set("to", request.To)
+	params.Set("status", request.Status)
+	params.Set("service", request.Service)
+	params["tag"] = request.Tags
+	return alertFilterFromQuery(params)
+}
+
+func runBacktest(ctx context.Context, job *BacktestJob, rule *preparedRule, collections []*mongo.Collection, filter bson.M, limit int64) {
+	report := &BacktestReport{
+		FieldChanges:    make(map[string]int64),
+		PriorityChanges: make(map[string]int64),
+		Notifications:   make(map[string]int64),
+		Samples:         []BacktestSample{},
+		FirstErrors:     []string{},
+	}
+	backtestJobsMutex.Lock()
+	job.Report = report
+	backtestJobsMutex.Unlock()
+
+	defer job.cancel()
+
+	err := func() error {
+		for _, collection := range collections {
+			remaining := limit - report.Scanned
+			if remaining <= 0 {
+				return nil
+			}
+			findOptions := options.Find().SetSort(bson.D{{Key: "alertfirsttime.time", Value: 1}}).SetLimit(remaining)
+			cursor, err := collection.Find(ctx, filter, findOptions)
+			if err != nil {
+				return err
+			}
+			for cursor.Next(ctx) {
+				var alert models.DbAlert
+				if err := cursor.Decode(&alert); err != nil {
+					cursor.Close(ctx)
+					return err
+				}
+				outcome := backtestAlert(job.RuleType, rule, alert)
+				backtestJobsMutex.Lock()
+				report.add(outcome)
+				backtestJobsMutex.Unlock()
+			}
+			err = cursor.Err()
+			cursor.Close(ctx)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}()
+
+	backtestJobsMutex.Lock()
+	defer backtestJobsMutex.Unlock()
+	finished := time.Now()
+	job.FinishedAt = &finished
+	if ctx.Err() != nil {
+		job.Status = "cancelled"
+		return
+	}
+	if err != nil {
+		job.Status = "failed"
+		job.Error = err.Error()
+		return
+	}
+	job.Status = "completed"
+}
+
+// backtestOutcome is what the rule did to one alert.
+type backtestOutcome struct {
+	err            string // evaluation error, empty when none
+	failed         bool   // the alert could not be evaluated at all
+	matched        bool
+	fieldChanges   []string
+	priorityChange string
+	dropped        string
+	notification   string
+	sample         BacktestSample
+}
+
+// backtestAlert evaluates the rule against one stored alert. It runs without
+// holding backtestJobsMutex; the outcome is merged into the report by add.
+func backtestAlert(ruleType string, rule *preparedRule, stored models.DbAlert) backtestOutcome {
+	var outcome backtestOutcome
+	alert := deepCopy(stored)
+	alertMap, err := alertToMap(&alert)
+	if err != nil {
+		outcome.failed = true
+		return outcome
+	}
+
+	matched, _, evalErr := ruleengine.EvaluateRulesGroupWithOptions(alertMap, rule.group, ruleengine.Options{DryRun: true, Now: stored.AlertFirstTime.Time})
+	if evalErr != nil {
+		outcome.err = fmt.Sprintf("%s: %v", stored.ID.Hex(), evalErr)
+	}
+	if !matched {
+		return outcome
+	}
+	outcome.matched = true
+
+	actions := rule.apply(&alert)
+	outcome.fieldChanges = changedAlertFields(stored, alert)
+	if alert.AlertPriority != stored.AlertPriority {
+		outcome.priorityChange = stored.AlertPriority + " -> " + alert.AlertPriority
+	}
+	if alert.AlertDropped != stored.AlertDropped {
+		outcome.dropped = alert.AlertDropped
+	}
+	if ruleType == "notify" && alert.AlertDropped != models.AlertDroppedYes {
+		if alert.Grouped && !alert.Parent && alert.GroupIncidentId != "" {
+			outcome.notification = "note to parent incident"
+		} else {
+			outcome.notification = "create incident"
+		}
+	}
+	outcome.sample = BacktestSample{
+		AlertID:  stored.ID.Hex(),
+		Entity:   stored.Entity,
+		Summary:  stored.AlertSummary,
+		Priority: stored.AlertPriority,
+		Actions:  actions,
+	}
+	return outcome
+}
+
+// add counts one alert's outcome; the caller holds backtestJobsMutex.
+func (report *BacktestReport) add(outcome backtestOutcome) {
+	report.Scanned++
+	if outcome.failed {
+		report.Errors++
+		return
+	}
+	if outcome.err != "" {
+		report.Errors++
+		if len(report.FirstErrors) < backtestSamples {
+			report.FirstErrors = append(report.FirstErrors, outcome.err)
+		}
+	}
+	if !outcome.matched {
+		return
+	}
+	report.Matched++
+
+	for _, field := range outcome.fieldChanges {
+		report.FieldChanges[field]++
+	}
+	if outcome.priorityChange != "" {
+		report.PriorityChanges[outcome.priorityChange]++
+	}
+	switch outcome.dropped {
+	case models.AlertDroppedYes:
+		report.Dropped++
+	case models.AlertDiscarded:
+		report.Discarded++
+	}
+	if outcome.notification != "" {
+		report.Notifications[outcome.notification]++
+	}
+	if len(report.Samples) < backtestSamples {
+		report.Samples = append(report.Samples, outcome.sample)
+	}
+}
+
+// changedAlertFields lists the string fields and tags that differ between two
+// versions of an alert, tags as "tag:<name>".
+func changedAlertFields(before, after models.DbAlert) []string {
+	var changed []string
+	b, a := reflect.ValueOf(before), reflect.ValueOf(after)
+	for i := 0; i < b.NumField(); i++ {
+		if b.Field(i).Kind() == reflect.String && b.Field(i).String() != a.Field(i).String() {
+			changed = append(changed, b.Type().Field(i).Name)
+		}
+	}
+
+	tags := make(map[string]bool)
+	for key := range before.AdditionalDetails {
+		tags[key] = true
+	}
+	for key := range after.AdditionalDetails {
+		tags[key] = true
+	}
+	for key := range tags {
+		if fmt.Sprintf("%v", before.AdditionalDetails[key]) != fmt.Sprintf("%v", after.AdditionalDetails[key]) {
+			changed = append(changed, "tag:"+key)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
@@ -0,0 +1,399 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"alertmanager/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"golang.org/x/exp/slices"
+)
+
+const cmdbCollection = "cmdbentities"
+
+// cmdbImportColumns are the CSV columns understood by the import. Aliases
+// and ips hold several values separated by ";".
+var cmdbImportColumns = []string{"name", "aliases", "ips", "owner", "environment", "criticality", "lifecycle"}
+
+// CmdbImportResult reports the outcome of an import.
+type CmdbImportResult struct {
+	Imported  int            `json:"imported"`
+	Errors    []string       `json:"errors"`
+	Conflicts []CmdbConflict `json:"conflicts"`
+}
+
+// CmdbConflict is a name, alias or IP that already belongs to another entity.
+type CmdbConflict struct {
+	Entry    int    `json:"entry,omitempty"` // position in an import, from 1
+	Name     string `json:"name"`
+	Key      string `json:"key"`
+	ExistsOn string `json:"exists_on"`
+}
+
+// EnsureCmdbIndexes makes entity names and match keys unique. Keys hold the
+// lower-cased names, aliases and IPs of all entities, so the unique multikey
+// index guarantees an alert can only ever match a single entity.
+func EnsureCmdbIndexes(mongoClient *mongo.Client) error {
+	indexView := mongoClient.Database(mongodatabase).Collection(cmdbCollection).Indexes()
+
+	// Earlier versions created a non-unique keys index, which would conflict.
+	specs, err := indexView.ListSpecifications(context.TODO())
+	if err != nil {
+		return err
+	}
+	for _, spec := range specs {
+		if spec.Name == "keys_1" && (spec.Unique == nil || !*spec.Unique) {
+			if _, err := indexView.DropOne(context.TODO(), spec.Name); err != nil {
+				return err
+			}
+		}
+	}
+
+	indexes := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "name", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "keys", Value: 1}}, Options: options.Index().SetUnique(true)},
+	}
+	_, err = indexView.CreateMany(context.TODO(), indexes)
+	return err
+}
+
+// findCmdbConflict returns which of the entity's keys another entity already
+// uses, after a save failed with a duplicate key error.
+func findCmdbConflict(ctx context.Context, collection *mongo.Collection, entity *models.CmdbEntity) (*CmdbConflict, error) {
+	filter := bson.M{"keys": bson.M{"$in": entity.Keys}}
+	if !entity.ID.IsZero() {
+		filter["_id"] = bson.M{"$ne": entity.ID}
+	} else {
+		filter["name"] = bson.M{"$ne": entity.Name}
+	}
+	var existing models.CmdbEntity
+	if err := collection.FindOne(ctx, filter).Decode(&existing); err != nil {
+		return nil, err
+	}
+	conflict := &CmdbConflict{Name: entity.Name, ExistsOn: existing.Name}
+	for _, key := range existing.Keys {
+		if slices.Contains(entity.Keys, key) {
+			conflict.Key = key
+			break
+		}
+	}
+	return conflict, nil
+}
+
+// writeCmdbConflict answers a save that failed with a duplicate key error.
+func writeCmdbConflict(w http.ResponseWriter, collection *mongo.Collection, entity *models.CmdbEntity) {
+	conflict, err := findCmdbConflict(context.TODO(), collection, entity)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Entity %q conflicts with an existing entity", entity.Name), http.StatusConflict)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusConflict)
+	json.NewEncoder(w).Encode(conflict)
+}
+
+// CmdbEntitiesHandler serves /api/v1/cmdb/entities: GET lists entities,
+// optionally only those whose name, alias or IP starts with ?q=, POST
+// creates one.
+func CmdbEntitiesHandler(w http.ResponseWriter, r *http.Request, mongoClient *mongo.Client) {
+	collection := mongoClient.Database(mongodatabase).Collection(cmdbCollection)
+
+	switch r.Method {
+	case http.MethodGet:
+		filter := bson.M{}
+		if q := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("q"))); q != "" {
+			filter["keys"] = primitive.Regex{Pattern: "^" + regexp.QuoteMeta(q)}
+		}
+		cursor, err := collection.Find(context.TODO(), filter, options.Find().SetSort(bson.D{{Key: "name", Value: 1}}))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		entities := []models.CmdbEntity{}
+		if err := cursor.All(context.TODO(), &entities); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(entities)
+
+	case http.MethodPost:
+		entity, err := decodeCmdbEntity(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		entity.ID = primitive.NewObjectID()
+		if _, err := collection.InsertOne(context.TODO(), entity); mongo.IsDuplicateKeyError(err) {
+			writeCmdbConflict(w, collection, entity)
+			return
+		} else if err != nil {
+			http.Error(w, fmt.Sprintf("Error saving entity: %v", err), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(entity)
+
+	default:
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+	}
+}
+
+// CmdbEntityHandler serves /api/v1/cmdb/entities/{id}: GET, PUT and DELETE.
+func CmdbEntityHandler(w http.ResponseWriter, r *http.Request, mongoClient *mongo.Client) {
+	id, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid entity id", http.StatusBadRequest)
+		return
+	}
+	collection := mongoClient.Database(mongodatabase).Collection(cmdbCollection)
+	filter := bson.M{"_id": id}
+
+	switch r.Method {
+	case http.MethodGet:
+		var entity models.CmdbEntity
+		err := collection.FindOne(context.TODO(), filter).Decode(&entity)
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Entity not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(entity)
+
+	case http.MethodPut:
+		entity, err := decodeCmdbEntity(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		entity.ID = id
+		result, err := collection.ReplaceOne(context.TODO(), filter, entity)
+		if mongo.IsDuplicateKeyError(err) {
+			writeCmdbConflict(w, collection, entity)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if result.MatchedCount == 0 {
+			http.Error(w, "Entity not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(entity)
+
+	case http.MethodDelete:
+		result, err := collection.DeleteOne(context.TODO(), filter)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if result.DeletedCount == 0 {
+			http.Error(w, "Entity not found", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+	}
+}
+
+// CmdbImportHandler upserts entities by name from a JSON array or, with
+// Content-Type text/csv, from CSV with the columns in cmdbImportColumns
+// (header required, any order, unknown columns ignored). Invalid entries are
+// reported and skipped. Entries whose name, aliases or IPs belong to another
+// entity are listed as conflicts and the response status is 409.
+func CmdbImportHandler(w http.ResponseWriter, r *http.Request, mongoClient *mongo.Client) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var entities []models.CmdbEntity
+	var err error
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "text/csv") {
+		entities, err = parseCmdbCSV(r.Body)
+	} else {
+		var body []byte
+		if body, err = ioutil.ReadAll(r.Body); err == nil {
+			if err = json.Unmarshal(body, &entities); err != nil {
+				err = fmt.Errorf("Error parsing JSON: %v", err)
+			}
+		}
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	collection := mongoClient.Database(mongodatabase).Collection(cmdbCollection)
+	result := CmdbImportResult{Errors: []string{}, Conflicts: []CmdbConflict{}}
+	for i, entity := range entities {
+		entity.Normalize()
+		entity.UpdatedAt = time.Now()
+		if err := entity.Validate(); err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("entry %d: %v", i+1, err))
+			continue
+		}
+		entity.ID = primitive.NilObjectID
+		update := bson.M{"$set": entity, "$setOnInsert": bson.M{"_id": primitive.NewObjectID()}}
+		_, err := collection.UpdateOne(context.TODO(), bson.M{"name": entity.Name}, update, options.Update().SetUpsert(true))
+		if mongo.IsDuplicateKeyError(err) {
+			if conflict, findErr := findCmdbConflict(context.TODO(), collection, &entity); findErr == nil {
+				conflict.Entry = i + 1
+				result.Conflicts = append(result.Conflicts, *conflict)
+				continue
+			}
+		}
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("entry %d (%s): %v", i+1, entity.Name, err))
+			continue
+		}
+		result.Imported++
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if len(result.Conflicts) > 0 {
+		w.WriteHeader(http.StatusConflict)
+	}
+	json.NewEncoder(w).Encode(result)
+}
+
+func decodeCmdbEntity(r *http.Request) (*models.CmdbEntity, error) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading request body")
+	}
+	var entity models.CmdbEntity
+	if err := json.Unmarshal(body, &entity); err != nil {
+		return nil, fmt.Errorf("Error parsing JSON: %v", err)
+	}
+	entity.Normalize()
+	entity.UpdatedAt = time.Now()
+	if err := entity.Validate(); err != nil {
+		return nil, fmt.Errorf("Invalid entity: %v", err)
+	}
+	return &entity, nil
+}
+
+func parseCmdbCSV(reader io.Reader) ([]models.CmdbEntity, error) {
+	csvReader := csv.NewReader(reader)
+	csvReader.TrimLeadingSpace = true
+	csvReader.FieldsPerRecord = -1
+	records, err := csvReader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing CSV: %v", err)
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("CSV needs a header row")
+	}
+
+	columns := make(map[string]int)
+	for i, name := range records[0] {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["name"]; !ok {
+		return nil, fmt.Errorf("CSV needs a name column, known columns are %s", strings.Join(cmdbImportColumns, ", "))
+	}
+
+	entities := make([]models.CmdbEntity, 0, len(records)-1)
+	for _, record := range records[1:] {
+		get := func(column string) string {
+			if i, ok := columns[column]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		entities = append(entities, models.CmdbEntity{
+			Name:        get("name"),
+			Aliases:     strings.Split(get("aliases"), ";"),
+			IPs:         strings.Split(get("ips"), ";"),
+			Owner:       get("owner"),
+			Environment: get("environment"),
+			Criticality: get("criticality"),
+			Lifecycle:   get("lifecycle"),
+		})
+	}
+	return entities, nil
+}
+
+// findCmdbEntity returns the entity matching the alert's entity, or failing
+// that its IP address, or nil. Keys are unique across entities, so a key
+// matches at most one entity.
+func findCmdbEntity(ctx context.Context, mongoClient *mongo.Client, entityName string, ipAddress string) (*models.CmdbEntity, error) {
+	collection := mongoClient.Database(mongodatabase).Collection(cmdbCollection)
+	for _, key := range []string{entityName, ipAddress} {
+		key = strings.ToLower(strings.TrimSpace(key))
+		if key == "" {
+			continue
+		}
+		var entity models.CmdbEntity
+		err := collection.FindOne(ctx, bson.M{"keys": key}).Decode(&entity)
+		if err == mongo.ErrNoDocuments {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		return &entity, nil
+	}
+	return nil, nil
+}
+
+// enrichFromCmdb normalises the alert's entity to the CMDB name, keeping the
+// name the source sent as the original_entity tag, fills IpAddress when the
+// source sent none, and adds the owner, environment, criticality and
+// lifecycle tags without replacing tags the source already sent.
+func enrichFromCmdb(alert *models.DbAlert, mongoClient *mongo.Client) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	entity, err := findCmdbEntity(ctx, mongoClient, alert.Entity, alert.IpAddress)
+	if err != nil {
+		fmt.Println("Error looking up CMDB entity:", err)
+		return
+	}
+	if entity == nil {
+		return
+	}
+
+	if alert.AdditionalDetails == nil {
+		alert.AdditionalDetails = make(map[string]interface{})
+	}
+	if alert.Entity != entity.Name {
+		if _, exists := alert.AdditionalDetails["original_entity"]; !exists {
+			alert.AdditionalDetails["original_entity"] = alert.Entity
+		}
+		alert.Entity = entity.Name
+	}
+	if alert.IpAddress == "" && len(entity.IPs) > 0 {
+		alert.IpAddress = entity.IPs[0]
+	}
+	tags := map[string]string{
+		"owner":       entity.Owner,
+		"environment": entity.Environment,
+		"criticality": entity.Criticality,
+		"lifecycle":   entity.Lifecycle,
+	}
+	for name, value := range tags {
+		if _, exists := alert.AdditionalDetails[name]; !exists && value != "" {
+			alert.AdditionalDetails[name] = value
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"alertmanager/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const ruleStatsCollection = "rulestats"
+
+// recordRuleDrop counts an alert dropped or discarded by an alert rule.
+func recordRuleDrop(mongoClient *mongo.Client, alertRule models.DbAlertRule, dropped string) {
+	counter := "dropped"
+	if dropped == models.AlertDiscarded {
+		counter = "discarded"
+	}
+	update := bson.M{
+		"$inc": bson.M{counter: 1},
+		"$set": bson.M{
+			"rulekind":      "alert",
+			"rulename":      alertRule.RuleName,
+			"lastDroppedAt": time.Now(),
+		},
+	}
+	collection := mongoClient.Database(mongodatabase).Collection(ruleStatsCollection)
+	_, err := collection.UpdateOne(context.TODO(), bson.M{"_id": alertRule.ID}, update, options.Update().SetUpsert(true))
+	if err != nil {
+		fmt.Println("Error recording rule drop:", err)
+	}
+}
+
+// RuleDropStatsHandler lists the alert rules that dropped or discarded
+// alerts, busiest first.
+func RuleDropStatsHandler(w http.ResponseWriter, r *http.Request, mongoClient *mongo.Client) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	filter := bson.M{"$or": bson.A{
+		bson.M{"dropped": bson.M{"$gt": 0}},
+		bson.M{"discarded": bson.M{"$gt": 0}},
+	}}
+	findOptions := options.Find().SetSort(bson.D{{Key: "dropped", Value: -1}, {Key: "discarded", Value: -1}})
+
+	stats := []models.RuleStats{}
+	collection := mongoClient.Database(mongodatabase).Collection(ruleStatsCollection)
+	cursor, err := collection.Find(context.TODO(), filter, findOptions)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(context.TODO())
+	if err := cursor.All(context.TODO(), &stats); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
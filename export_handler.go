@@ -0,0 +1,392 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"alertmanager/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// exportFlushEvery controls how many rows are written before the response is
+// flushed to the client.
+const exportFlushEvery = 500
+
+// exportColumns are the fixed CSV columns, followed by one column per
+// additionaldetails key found in the exported alerts.
+var exportColumns = []string{
+	"_id", "alertid", "entity", "alertsource", "servicename", "alertsummary", "alertnotes",
+	"severity", "alertpriority", "alertstatus", "alertacked", "ipaddress", "alertcount",
+	"alertfirsttime", "alertlasttime", "alertcleartime",
+	"parent", "grouped", "groupincidentid", "groupidentifier", "groupalerts",
+	"alertdestination", "pagerduty_incident_id",
+}
+
+// alertExportWriter writes alerts in one export format.
+type alertExportWriter interface {
+	Write(alert models.DbAlert) error
+	Flush() error
+}
+
+func AlertExportHandler(w http.ResponseWriter, r *http.Request, mongoClient *mongo.Client) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx := context.TODO()
+
+	filter, err := alertFilterFromQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	collections, err := alertQueryCollections(mongoClient, r.URL.Query().Get("archive"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	withChildren := r.URL.Query().Get("with_children") == "true"
+
+	format := strings.ToLower(r.URL.Query().Get("format"))
+	if format == "" {
+		format = "ndjson"
+	}
+	if format != "csv" && format != "ndjson" {
+		http.Error(w, "Invalid format, use csv or ndjson", http.StatusBadRequest)
+		return
+	}
+
+	// With children, only top level alerts are streamed and each parent is
+	// followed directly by its children so incidents stay together.
+	if withChildren {
+		filter["grouped"] = bson.M{"$ne": true}
+	}
+
+	var tagKeys []string
+	if format == "csv" {
+		tagKeys, err = additionalDetailKeys(ctx, collections, filter, withChildren)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=alerts-%s.%s", time.Now().Format("20060102-150405"), format))
+
+	var writer alertExportWriter
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv")
+		writer, err = newCSVExportWriter(w, tagKeys)
+		if err != nil {
+			fmt.Println("Error writing export header:", err)
+			return
+		}
+	} else {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		writer = &ndjsonExportWriter{encoder: json.NewEncoder(w)}
+	}
+
+	flusher, _ := w.(http.Flusher)
+	rows := 0
+	emit := func(alert models.DbAlert) error {
+		if err := writer.Write(alert); err != nil {
+			return err
+		}
+		rows++
+		if rows%exportFlushEvery == 0 {
+			if err := writer.Flush(); err != nil {
+				return err
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		return nil
+	}
+
+	for _, collection := range collections {
+		if err := exportCollection(ctx, collection, filter, withChildren, emit); err != nil {
+			fmt.Println("Error writing export, aborting:", err)
+			abortExport(w, writer, format, err)
+			return
+		}
+	}
+
+	writer.Flush()
+	fmt.Printf("Exported %d alerts as %s\n", rows, format)
+}
+
+// abortExport ends an export that failed after the headers were sent, so
+// clients can tell it from a complete file. NDJSON gets a trailing
+// {"error": ...} record; CSV has no place for one, so the response is cut off
+// without its final chunk.
+func abortExport(w http.ResponseWriter, writer alertExportWriter, format string, err error) {
+	if format == "ndjson" {
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	writer.Flush()
+	panic(http.ErrAbortHandler)
+}
+
+// exportCollection streams the alerts matching filter from one collection.
+// Parents are followed by their children when withChildren is set.
+func exportCollection(ctx context.Context, collection *mongo.Collection, filter bson.M, withChildren bool, emit func(models.DbAlert) error) error {
+	findOptions := options.Find().SetSort(bson.D{{Key: "alertfirsttime.time", Value: 1}})
+	cursor, err := collection.Find(ctx, filter, findOptions)
+	if err != nil {
+		return fmt.Errorf("finding alerts: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var alert models.DbAlert
+		if err := cursor.Decode(&alert); err != nil {
+			return fmt.Errorf("decoding alert: %v", err)
+		}
+		if err := emit(alert); err != nil {
+			return err
+		}
+		if withChildren && len(alert.GroupAlerts) > 0 {
+			if err := exportChildren(ctx, collection, alert, emit); err != nil {
+				return err
+			}
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return fmt.Errorf("reading alerts: %v", err)
+	}
+	return nil
+}
+
+// exportChildren streams the children of a parent incident.
+func exportChildren(ctx context.Context, collection *mongo.Collection, parent models.DbAlert, emit func(models.DbAlert) error) error {
+	findOptions := options.Find().SetSort(bson.D{{Key: "alertfirsttime.time", Value: 1}})
+	cursor, err := collection.Find(ctx, bson.M{"_id": bson.M{"$in": parent.GroupAlerts}}, findOptions)
+	if err != nil {
+		return fmt.Errorf("finding children of %s: %v", parent.ID.Hex(), err)
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var child models.DbAlert
+		if err := cursor.Decode(&child); err != nil {
+			return fmt.Errorf("decoding child of %s: %v", parent.ID.Hex(), err)
+		}
+		if err := emit(child); err != nil {
+			return err
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return fmt.Errorf("reading children of %s: %v", parent.ID.Hex(), err)
+	}
+	return nil
+}
+
+// alertFilterFromQuery builds an alert filter from the common query
+// parameters: from, to, status, service and repeated tag=key:value.
+func alertFilterFromQuery(params url.Values) (bson.M, error) {
+	filter := bson.M{}
+
+	timeRange := bson.M{}
+	if val := params.Get("from"); val != "" {
+		t, err := parseFilterTime(val)
+		if err != nil {
+			return nil, fmt.Errorf("invalid from: %v", err)
+		}
+		timeRange["$gte"] = t
+	}
+	if val := params.Get("to"); val != "" {
+		t, err := parseFilterTime(val)
+		if err != nil {
+			return nil, fmt.Errorf("invalid to: %v", err)
+		}
+		timeRange["$lte"] = t
+	}
+	if len(timeRange) > 0 {
+		filter["alertfirsttime.time"] = timeRange
+	}
+
+	if val := params.Get("status"); val != "" {
+		filter["alertstatus"] = strings.ToUpper(val)
+	}
+	if val := params.Get("service"); val != "" {
+		filter["servicename"] = val
+	}
+
+	for _, tag := range params["tag"] {
+		key, value, ok := strings.Cut(tag, ":")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid tag filter %q, use key:value", tag)
+		}
+		filter["additionaldetails."+key] = value
+	}
+	return filter, nil
+}
+
+// parseFilterTime accepts RFC3339 as well as the alert time layout.
+func parseFilterTime(val string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, val); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02 15:04:05", val)
+}
+
+// additionalDetailKeys returns the sorted set of additionaldetails keys used
+// by the alerts matching filter, and by their children when withChildren is
+// set, so the CSV header is known before streaming.
+func additionalDetailKeys(ctx context.Context, collections []*mongo.Collection, filter bson.M, withChildren bool) ([]string, error) {
+	keysOf := func(details string) mongo.Pipeline {
+		return mongo.Pipeline{
+			{{Key: "$project", Value: bson.M{
+				"keys": bson.M{"$map": bson.M{
+					"input": bson.M{"$objectToArray": details},
+					"in":    "$$this.k",
+				}},
+			}}},
+			{{Key: "$unwind", Value: "$keys"}},
+			{{Key: "$group", Value: bson.M{"_id": nil, "keys": bson.M{"$addToSet": "$keys"}}}},
+		}
+	}
+
+	unique := make(map[string]bool)
+	aggregate := func(collection *mongo.Collection, pipeline mongo.Pipeline) error {
+		cursor, err := collection.Aggregate(ctx, pipeline)
+		if err != nil {
+			return err
+		}
+		var results []struct {
+			Keys []string `bson:"keys"`
+		}
+		if err = cursor.All(ctx, &results); err != nil {
+			return err
+		}
+		for _, res := range results {
+			for _, key := range res.Keys {
+				unique[key] = true
+			}
+		}
+		return nil
+	}
+
+	for _, collection := range collections {
+		pipeline := append(mongo.Pipeline{{{Key: "$match", Value: filter}}}, keysOf("$additionaldetails")...)
+		if err := aggregate(collection, pipeline); err != nil {
+			return nil, err
+		}
+		if !withChildren {
+			continue
+		}
+		// Children are exported from the collection their parent is in.
+		children := append(mongo.Pipeline{
+			{{Key: "$match", Value: filter}},
+			{{Key: "$match", Value: bson.M{"groupalerts.0": bson.M{"$exists": true}}}},
+			{{Key: "$lookup", Value: bson.M{"from": collection.Name(), "localField": "groupalerts", "foreignField": "_id", "as": "children"}}},
+			{{Key: "$unwind", Value: "$children"}},
+		}, keysOf("$children.additionaldetails")...)
+		if err := aggregate(collection, children); err != nil {
+			return nil, err
+		}
+	}
+
+	keys := make([]string, 0, len(unique))
+	for key := range unique {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+type ndjsonExportWriter struct {
+	encoder *json.Encoder
+}
+
+func (n *ndjsonExportWriter) Write(alert models.DbAlert) error {
+	return n.encoder.Encode(alert)
+}
+
+func (n *ndjsonExportWriter) Flush() error {
+	return nil
+}
+
+type csvExportWriter struct {
+	writer  *csv.Writer
+	tagKeys []string
+}
+
+func newCSVExportWriter(w http.ResponseWriter, tagKeys []string) (*csvExportWriter, error) {
+	c := &csvExportWriter{writer: csv.NewWriter(w), tagKeys: tagKeys}
+
+	header := append([]string{}, exportColumns...)
+	for _, key := range tagKeys {
+		header = append(header, "additionaldetails."+key)
+	}
+	if err := c.writer.Write(header); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *csvExportWriter) Write(alert models.DbAlert) error {
+	groupAlerts := make([]string, 0, len(alert.GroupAlerts))
+	for _, id := range alert.GroupAlerts {
+		groupAlerts = append(groupAlerts, id.Hex())
+	}
+
+	row := []string{
+		alert.ID.Hex(), alert.AlertId, alert.Entity, alert.AlertSource, alert.ServiceName, alert.AlertSummary, alert.AlertNotes,
+		alert.Severity, alert.AlertPriority, alert.AlertStatus, alert.AlertAcked, alert.IpAddress, strconv.Itoa(alert.AlertCount),
+		formatExportTime(alert.AlertFirstTime), formatExportTime(alert.AlertLastTime), formatExportTime(alert.AlertClearTime),
+		strconv.FormatBool(alert.Parent), strconv.FormatBool(alert.Grouped), alert.GroupIncidentId, alert.GroupIdentifier, strings.Join(groupAlerts, ";"),
+		alert.AlertDestination, alert.PagerDutyIncidentId,
+	}
+	for _, key := range c.tagKeys {
+		row = append(row, formatExportValue(alert.AdditionalDetails[key]))
+	}
+	return c.writer.Write(row)
+}
+
+func (c *csvExportWriter) Flush() error {
+	c.writer.Flush()
+	return c.writer.Error()
+}
+
+func formatExportTime(t models.CustomTime) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format("2006-01-02 15:04:05")
+}
+
+// formatExportValue renders a tag value as a single CSV cell. Nested values
+// are written as JSON.
+func formatExportValue(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return val
+	case map[string]interface{}, []interface{}, bson.M, bson.A:
+		b, err := json.Marshal(val)
+		if err != nil {
+			return fmt.Sprintf("%v", val)
+		}
+		return string(b)
+	default:
+		return fmt.Sprintf("%v", val)
+	}
+}
@@ -7,7 +7,7 @@ require (
 	golang.org/x/exp v0.0.0-20240613232115-7f521ea00fb8
 )
 
-require github.com/neo4j/neo4j-go-driver/v5 v5.28.4 // indirect
+require github.com/neo4j/neo4j-go-driver/v5 v5.28.4
 
 require (
 	github.com/golang/snappy v0.0.1 // indirect
@@ -7,6 +7,7 @@ import (
     "strings"
     
     "alertmanager/models"
+    "alertmanager/ruleengine"
     "alertmanager/utilities"
     "go.mongodb.org/mongo-driver/bson"
     "go.mongodb.org/mongo-driver/bson/primitive"
@@ -140,40 +141,14 @@ func calculateScore(a, b map[string]interface{}, fields []string) float64 {
     return total / float64(validFields)
 }
 
+// getMapValue resolves a field or tag the same way the rule engine does and
+// returns it as a string.
 func getMapValue(m map[string]interface{}, key string) (string, bool) {
-    target := strings.ToLower(key)
-    
-    // 1. Try Top Level (Case-insensitive search)
-    for k, v := range m {
-        if strings.ToLower(k) == target {
-            return fmt.Sprintf("%v", v), true
-        }
-    }
-    
-    // 2. Try AdditionalDetails
-    // We need to find the "AdditionalDetails" key in the map first (it might be "AdditionalDetails" or "additionaldetails" etc)
-    var adMap map[string]interface{}
-    foundAd := false
-    
-    for k, v := range m {
-        if strings.ToLower(k) == "additionaldetails" {
-            if val, ok := v.(map[string]interface{}); ok {
-                adMap = val
-                foundAd = true
-                break
-            }
-        }
+    val, found := ruleengine.ResolveField(m, key)
+    if !found {
+        return "", false
     }
-    
-    if foundAd {
-        for k, v := range adMap {
-            if strings.ToLower(k) == target {
-                 return fmt.Sprintf("%v", v), true
-            }
-        }
-    }
-    
-    return "", false
+    return fmt.Sprintf("%v", val), true
 }
 
 func isTopLevel(key string) bool {
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+
+	"alertmanager/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const lookupTableCollection = "lookuptables"
+
+// compiledLookupTable indexes a lookup table by match type so lookups follow
+// the documented precedence: exact, longest prefix, first wildcard, default.
+type compiledLookupTable struct {
+	ignoreCase bool
+	exact      map[string]models.LookupEntry
+	prefixes   []models.LookupEntry // longest prefix first
+	wildcards  []models.LookupEntry // in table order
+	fallback   map[string]string
+}
+
+func compileLookupTable(table models.LookupTable) *compiledLookupTable {
+	compiled := &compiledLookupTable{
+		ignoreCase: table.IgnoreCase,
+		exact:      make(map[string]models.LookupEntry),
+		fallback:   table.Default,
+	}
+	for _, entry := range table.Entries {
+		key := entry.Key
+		if table.IgnoreCase {
+			entry.Key = strings.ToLower(key)
+		}
+		switch {
+		case key == "*":
+			compiled.fallback = entry.Tags
+		case !strings.ContainsAny(key, "*?["):
+			compiled.exact[entry.Key] = entry
+		case strings.HasSuffix(key, "*") && !strings.ContainsAny(key[:len(key)-1], "*?["):
+			entry.Key = entry.Key[:len(entry.Key)-1]
+			compiled.prefixes = append(compiled.prefixes, entry)
+		default:
+			compiled.wildcards = append(compiled.wildcards, entry)
+		}
+	}
+	sort.SliceStable(compiled.prefixes, func(i, j int) bool {
+		return len(compiled.prefixes[i].Key) > len(compiled.prefixes[j].Key)
+	})
+	return compiled
+}
+
+// lookup returns the tags for key and whether any entry, or the default,
+// matched.
+func (t *compiledLookupTable) lookup(key string) (map[string]string, bool) {
+	if t.ignoreCase {
+		key = strings.ToLower(key)
+	}
+	if entry, ok := t.exact[key]; ok {
+		return entry.Tags, true
+	}
+	for _, entry := range t.prefixes {
+		if strings.HasPrefix(key, entry.Key) {
+			return entry.Tags, true
+		}
+	}
+	for _, entry := range t.wildcards {
+		if matched, _ := path.Match(entry.Key, key); matched {
+			return entry.Tags, true
+		}
+	}
+	return t.fallback, len(t.fallback) > 0
+}
+
+// parseLookupCSV reads a lookup table from CSV. The header names the tags;
+// its first column is the key column whatever it is called. Empty cells set
+// no tag, and a row with the key "*" is the default.
+func parseLookupCSV(reader io.Reader) ([]models.LookupEntry, map[string]string, error) {
+	csvReader := csv.NewReader(reader)
+	csvReader.TrimLeadingSpace = true
+	records, err := csvReader.ReadAll()
+	if err != nil {
+		return nil, nil, fmt.Errorf("Error parsing CSV: %v", err)
+	}
+	if len(records) == 0 || len(records[0]) < 2 {
+		return nil, nil, fmt.Errorf("CSV needs a header with a key column and at least one tag column")
+	}
+
+	header := records[0]
+	var entries []models.LookupEntry
+	var fallback map[string]string
+	for line, record := range records[1:] {
+		key := strings.TrimSpace(record[0])
+		if key == "" {
+			return nil, nil, fmt.Errorf("line %d: empty key", line+2)
+		}
+		tags := make(map[string]string)
+		for i := 1; i < len(record) && i < len(header); i++ {
+			if value := strings.TrimSpace(record[i]); value != "" {
+				tags[strings.TrimSpace(header[i])] = value
+			}
+		}
+		if key == "*" {
+			fallback = tags
+			continue
+		}
+		entries = append(entries, models.LookupEntry{Key: key, Tags: tags})
+	}
+	return entries, fallback, nil
+}
+
+// LookupImportHandler replaces the entries of a lookup table with a CSV
+// upload (POST /api/v1/rules/lookuptables/{id}/import). With mode=merge the
+// rows are added to the table instead, replacing entries with the same key.
+// The import is recorded as a new revision of the table.
+func LookupImportHandler(w http.ResponseWriter, r *http.Request, mongoClient *mongo.Client) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	id, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid lookup table id", http.StatusBadRequest)
+		return
+	}
+
+	entries, fallback, err := parseLookupCSV(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var table models.LookupTable
+	collection := mongoClient.Database(mongodatabase).Collection(lookupTableCollection)
+	err = collection.FindOne(context.TODO(), bson.M{"_id": id}).Decode(&table)
+	if err == mongo.ErrNoDocuments {
+		http.Error(w, "Lookup table not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if r.URL.Query().Get("mode") == "merge" {
+		imported := make(map[string]bool, len(entries))
+		for _, entry := range entries {
+			imported[entry.Key] = true
+		}
+		merged := []models.LookupEntry{}
+		for _, entry := range table.Entries {
+			if !imported[entry.Key] {
+				merged = append(merged, entry)
+			}
+		}
+		table.Entries = append(merged, entries...)
+		if fallback != nil {
+			table.Default = fallback
+		}
+	} else {
+		table.Entries = entries
+		table.Default = fallback
+	}
+
+	if err := table.Validate(); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid lookup table: %v", err), http.StatusBadRequest)
+		return
+	}
+	if err := replaceRule(context.TODO(), mongoClient, lookupTableCollection, id, &table, models.RevisionActionUpdate, ruleAuthor(r)); err != nil {
+		http.Error(w, err.Error(), ruleWriteStatus(err))
+		return
+	}
+	reloadAfterRuleChange(mongoClient, "import on "+lookupTableCollection)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(table)
+}
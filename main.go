@@ -4,18 +4,17 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"os"
-	"regexp"
+	"sort"
 	"strings"
 	"time"
 
-	"reflect"
 
-	"github.com/mitchellh/mapstructure"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -102,7 +101,7 @@ func check_flap() (string,error){
 		"birthdate": time.Date(1990, 6, 12, 0, 0, 0, 0, time.UTC),
 	}
 
-	res := ruleengine.EvaluateRulesGroup(data, rulesGroup)
+	res, _ := ruleengine.EvaluateRulesGroup(data, rulesGroup)
 
 	fmt.Println("The result is ", res)
 
@@ -111,8 +110,8 @@ func check_flap() (string,error){
 
 func main() {
 	
-	fmt.Println("\n\x1b[32mStarting EA API Server.....\x1b[0m\n")
-	fmt.Println("\x1b[32mStarting mongo connection.....\x1b[0m\n")
+	fmt.Println("\n\x1b[32mStarting EA API Server.....\x1b[0m")
+	fmt.Println("\x1b[32mStarting mongo connection.....\x1b[0m")
 
  	serverAPI := options.ServerAPI(options.ServerAPIVersion1)
 	opts := options.Client().ApplyURI(mongouri).SetServerAPIOptions(serverAPI)
@@ -132,7 +131,27 @@ func main() {
 		panic(err)
 	}
 	fmt.Println("\x1b[32mPinged your deployment. You successfully connected to MongoDB!\x1b[0m\n ")
-	fmt.Println("\x1b[32mWaiting for alerts.....\x1b[0m\n")
+	fmt.Println("\x1b[32mWaiting for alerts.....\x1b[0m")
+
+	if err := EnsureSearchIndexes(mongoClient.Database(mongodatabase).Collection(mongocollection)); err != nil {
+		fmt.Println("Error creating alert search index:", err)
+	}
+	if err := EnsureSearchIndexes(mongoClient.Database(mongodatabase).Collection(alertArchiveCollection)); err != nil {
+		fmt.Println("Error creating archive search index:", err)
+	}
+	StartRetentionWorker(mongoClient)
+
+	if _, err := ReloadRules(mongoClient, "startup"); err != nil {
+		fmt.Println("Error loading rules:", err)
+	}
+	StartRuleReloader(mongoClient)
+	StartRuleStatsFlusher(mongoClient)
+	if err := EnsureRuleRevisionIndexes(mongoClient); err != nil {
+		fmt.Println("Error creating rule revision index:", err)
+	}
+	if err := EnsureCmdbIndexes(mongoClient); err != nil {
+		fmt.Println("Error creating CMDB indexes:", err)
+	}
 
 	// Connect to Neo4j
 	if neo4jUri == "" {
@@ -149,7 +168,7 @@ func main() {
 		if err := neo4jDriver.VerifyConnectivity(ctx); err != nil {
 			fmt.Println("Error verifying Neo4j connectivity:", err)
 		} else {
-			fmt.Println("\x1b[32mConnected to Neo4j!\x1b[0m\n")
+			fmt.Println("\x1b[32mConnected to Neo4j!\x1b[0m")
 		}
 		// Close driver when main exits
 		defer neo4jDriver.Close(context.Background())
@@ -169,14 +188,80 @@ func main() {
 	http.HandleFunc("/api/v1/dashboard/trends", func(w http.ResponseWriter, r *http.Request) {
 		AlertTrendsHandler(w, r, mongoClient)
 	})
+	http.HandleFunc("/api/v1/dashboard/rules", func(w http.ResponseWriter, r *http.Request) {
+		RuleDashboardHandler(w, r, mongoClient)
+	})
+
+	// Rule Management
+	http.HandleFunc("/api/v1/rules/reload", func(w http.ResponseWriter, r *http.Request) {
+		RuleReloadHandler(w, r, mongoClient)
+	})
+	http.HandleFunc("/api/v1/rules/test", func(w http.ResponseWriter, r *http.Request) {
+		RuleTestHandler(w, r, mongoClient)
+	})
+	http.HandleFunc("/api/v1/rules/dropstats", func(w http.ResponseWriter, r *http.Request) {
+		RuleDropStatsHandler(w, r, mongoClient)
+	})
+	http.HandleFunc("/api/v1/rules/stats", func(w http.ResponseWriter, r *http.Request) {
+		RuleStatsHandler(w, r, mongoClient)
+	})
+	http.HandleFunc("/api/v1/rules/backtest", func(w http.ResponseWriter, r *http.Request) {
+		BacktestHandler(w, r, mongoClient)
+	})
+	http.HandleFunc("/api/v1/rules/backtest/{id}", BacktestJobHandler)
+	http.HandleFunc("/api/v1/ruleengine/metrics", RuleEngineMetricsHandler)
+	http.HandleFunc("/api/v1/rules/{kind}", func(w http.ResponseWriter, r *http.Request) {
+		RulesHandler(w, r, mongoClient)
+	})
+	http.HandleFunc("/api/v1/rules/{kind}/{id}", func(w http.ResponseWriter, r *http.Request) {
+		RuleHandler(w, r, mongoClient)
+	})
+	http.HandleFunc("/api/v1/rules/{kind}/{id}/revisions", func(w http.ResponseWriter, r *http.Request) {
+		RuleRevisionsHandler(w, r, mongoClient)
+	})
+	http.HandleFunc("/api/v1/rules/{kind}/{id}/revisions/{revision}", func(w http.ResponseWriter, r *http.Request) {
+		RuleRevisionsHandler(w, r, mongoClient)
+	})
+	http.HandleFunc("/api/v1/rules/{kind}/{id}/diff", func(w http.ResponseWriter, r *http.Request) {
+		RuleDiffHandler(w, r, mongoClient)
+	})
+	http.HandleFunc("/api/v1/rules/lookuptables/{id}/import", func(w http.ResponseWriter, r *http.Request) {
+		LookupImportHandler(w, r, mongoClient)
+	})
+	http.HandleFunc("/api/v1/rules/{kind}/{id}/rollback", func(w http.ResponseWriter, r *http.Request) {
+		RuleRollbackHandler(w, r, mongoClient)
+	})
+
+	// Alert Search and Export
+	http.HandleFunc("/api/v1/alerts/search", func(w http.ResponseWriter, r *http.Request) {
+		AlertSearchHandler(w, r, mongoClient)
+	})
+	http.HandleFunc("/api/v1/alerts/{id}", func(w http.ResponseWriter, r *http.Request) {
+		AlertHandler(w, r, mongoClient)
+	})
+	http.HandleFunc("/api/v1/alerts/export", func(w http.ResponseWriter, r *http.Request) {
+		AlertExportHandler(w, r, mongoClient)
+	})
+	http.HandleFunc("/api/v1/cmdb/entities", func(w http.ResponseWriter, r *http.Request) {
+		CmdbEntitiesHandler(w, r, mongoClient)
+	})
+	http.HandleFunc("/api/v1/cmdb/entities/{id}", func(w http.ResponseWriter, r *http.Request) {
+		CmdbEntityHandler(w, r, mongoClient)
+	})
+	http.HandleFunc("/api/v1/cmdb/import", func(w http.ResponseWriter, r *http.Request) {
+		CmdbImportHandler(w, r, mongoClient)
+	})
+	http.HandleFunc("/api/v1/retention", func(w http.ResponseWriter, r *http.Request) {
+		RetentionHandler(w, r, mongoClient)
+	})
 
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		Handler(w, r, mongoClient)
+		Handler(w, r, mongoClient, neo4jDriver)
 	})
 	http.ListenAndServe(":8081", nil)
 }
 
-func Handler(w http.ResponseWriter, r *http.Request, mongoClient *mongo.Client ) {
+func Handler(w http.ResponseWriter, r *http.Request, mongoClient *mongo.Client, neo4jDriver neo4j.DriverWithContext) {
 
 	alertCollection := mongoClient.Database(mongodatabase).Collection(mongocollection)
 
@@ -227,43 +312,28 @@ func Handler(w http.ResponseWriter, r *http.Request, mongoClient *mongo.Client )
 		if err1 != nil {
 			if err1 == mongo.ErrNoDocuments {
 				fmt.Println("No matching event found. Creating Alert....")
-				layout := "2006-01-02 15:04:05"
-				parsedTime, err := time.Parse(layout, apiAlertData["alertTime"].(string))
+				newAlert, err := newAlertFromApiData(apiAlertData)
 				if err != nil {
 					fmt.Println("Error parsing time:", err)
 					return
 				}
-				// Create a alert in DB
-				
-				newAlert := models.DbAlert{
-					ID: 				primitive.ObjectID{},
-					Entity:				apiAlertData["entity"].(string),
-					AlertFirstTime:		models.CustomTime{Time: parsedTime},
-					AlertLastTime:		models.CustomTime{Time: parsedTime},
-					AlertClearTime:		models.CustomTime{},
-					AlertSource:		apiAlertData["alertSource"].(string),
-					ServiceName: 		apiAlertData["serviceName"].(string),
-					AlertSummary:		apiAlertData["alertSummary"].(string),
-					AlertStatus:		"OPEN",
-					AlertNotes:			getStringOrEmpty(apiAlertData, "alertNotes"),
-					AlertAcked:			"NO",
-					Severity:			apiAlertData["severity"].(string),
-					AlertId:			apiAlertData["alertId"].(string),
-					AlertPriority:		"P4",
-					IpAddress:			getStringOrEmpty(apiAlertData, "ipAddress"),
-					AlertCount:			1,
-					AdditionalDetails:	make(map[string]interface{}),
-					Grouped: 			false ,	
-					Parent:				false,
-				}
-
 
-				// Add additional Tags
-				//fmt.Println("The object before addTags is " , newAlert )
-				addTags(apiAlertData, &newAlert)
+				enrichFromCmdb(&newAlert, mongoClient)
+				enrichFromTopology(&newAlert, neo4jDriver)
 				fmt.Println("The object after addTags is " , newAlert )
 				processAlertRules( &newAlert , mongoClient)
+				if newAlert.AlertDropped == models.AlertDiscarded {
+					fmt.Println("Alert discarded by alert rules, not storing it")
+					w.Header().Add("Content-Type" , "application/json")
+					w.WriteHeader(200)
+					json.NewEncoder(w).Encode(map[string]interface{}{
+						"message": "Alert discarded",
+						"alertid": newAlert.AlertId,
+					})
+					return
+				}
 				processTagRules( &newAlert , mongoClient)
+				attachRunbooks(&newAlert, mongoClient)
 
 				insertResult , inserterr := alertCollection.InsertOne(context.TODO(), newAlert)
 
@@ -275,23 +345,28 @@ func Handler(w http.ResponseWriter, r *http.Request, mongoClient *mongo.Client )
 				fmt.Println("The insert result is ", *insertResult)
 				newAlert.ID = insertResult.InsertedID.(primitive.ObjectID)
 
-				// Now do the Notification processing rules
-				processGrouping(&newAlert , mongoClient)
-				
-				// CRITICAL: Reload alert from DB to get updated grouping information
-				// processGrouping() updates the DB but not the in-memory object
-				var reloadedAlert models.DbAlert
-				err = alertCollection.FindOne(context.TODO(), bson.M{"_id": newAlert.ID}).Decode(&reloadedAlert)
-				if err != nil {
-					fmt.Println("Warning: Could not reload alert from DB after grouping:", err)
-					// Continue with in-memory version as fallback
+				// Dropped alerts are kept for audit only
+				if newAlert.AlertDropped == models.AlertDroppedYes {
+					fmt.Println("Alert is dropped, skipping grouping and notification")
 				} else {
-					// Use the reloaded version which has updated Grouped and GroupIncidentId fields
-					newAlert = reloadedAlert
-					fmt.Printf("🔄 Reloaded alert from DB: Grouped=%v, GroupIncidentId=%s\n", newAlert.Grouped, newAlert.GroupIncidentId)
-				}
+					// Now do the Notification processing rules
+					processGrouping(&newAlert , mongoClient)
+				
+					// CRITICAL: Reload alert from DB to get updated grouping information
+					// processGrouping() updates the DB but not the in-memory object
+					var reloadedAlert models.DbAlert
+					err = alertCollection.FindOne(context.TODO(), bson.M{"_id": newAlert.ID}).Decode(&reloadedAlert)
+					if err != nil {
+						fmt.Println("Warning: Could not reload alert from DB after grouping:", err)
+						// Continue with in-memory version as fallback
+					} else {
+						// Use the reloaded version which has updated Grouped and GroupIncidentId fields
+						newAlert = reloadedAlert
+						fmt.Printf("🔄 Reloaded alert from DB: Grouped=%v, GroupIncidentId=%s\n", newAlert.Grouped, newAlert.GroupIncidentId)
+					}
 				
-				processNotifyRules( &newAlert , mongoClient)
+					processNotifyRules( &newAlert , mongoClient)
+				}
 
 				alertjsonData, err := json.Marshal(newAlert)
 				if err != nil {
@@ -454,6 +529,42 @@ func Handler(w http.ResponseWriter, r *http.Request, mongoClient *mongo.Client )
 	}
 }
 
+// newAlertFromApiData builds a new OPEN alert from an incoming API payload.
+// Keys that are not standard alert fields are copied into AdditionalDetails.
+func newAlertFromApiData(apiAlertData utilities.ApiAlertData) (models.DbAlert, error) {
+	layout := "2006-01-02 15:04:05"
+	parsedTime, err := time.Parse(layout, getStringOrEmpty(apiAlertData, "alertTime"))
+	if err != nil {
+		return models.DbAlert{}, err
+	}
+
+	newAlert := models.DbAlert{
+		ID: 				primitive.ObjectID{},
+		Entity:				getStringOrEmpty(apiAlertData, "entity"),
+		AlertFirstTime:		models.CustomTime{Time: parsedTime},
+		AlertLastTime:		models.CustomTime{Time: parsedTime},
+		AlertClearTime:		models.CustomTime{},
+		AlertSource:		getStringOrEmpty(apiAlertData, "alertSource"),
+		ServiceName: 		getStringOrEmpty(apiAlertData, "serviceName"),
+		AlertSummary:		getStringOrEmpty(apiAlertData, "alertSummary"),
+		AlertStatus:		"OPEN",
+		AlertNotes:			getStringOrEmpty(apiAlertData, "alertNotes"),
+		AlertAcked:			"NO",
+		Severity:			getStringOrEmpty(apiAlertData, "severity"),
+		AlertId:			getStringOrEmpty(apiAlertData, "alertId"),
+		AlertPriority:		"P4",
+		IpAddress:			getStringOrEmpty(apiAlertData, "ipAddress"),
+		AlertCount:			1,
+		AdditionalDetails:	make(map[string]interface{}),
+		Grouped: 			false ,
+		Parent:				false,
+	}
+
+	// Add additional Tags
+	addTags(apiAlertData, &newAlert)
+	return newAlert, nil
+}
+
 func addTags(apiAlertData map[string]interface{}, newAlert *models.DbAlert) bool {
 	Tags := make(map[string]interface{})
 	exA := utilities.ExcludeAttributes{
@@ -476,151 +587,193 @@ func addTags(apiAlertData map[string]interface{}, newAlert *models.DbAlert) bool
 }
 
 func processAlertRules(newAlert *models.DbAlert, mongoClient *mongo.Client) bool {
-	var rulesGroup ruleengine.RulesGroup
-	alertRulesCollection := mongoClient.Database(mongodatabase).Collection("alertrules")
-
-	cursor, err := alertRulesCollection.Find(context.TODO(), bson.D{})
-    if err != nil {
-        log.Fatal(err)
-    }
-    defer cursor.Close(context.TODO())
-
-	var alertRules []models.DbAlertRule
-	if err = cursor.All(context.TODO(), &alertRules); err != nil {
-        log.Fatal(err)
-    }
+	rules := currentRules(mongoClient)
 
-	for _, alertRule   := range alertRules {
+	for _, compiled := range rules.AlertRules {
+		alertRule := compiled.Rule
+		rulesGroup := compiled.Group
 		fmt.Println("Rule is ", alertRule.RuleObject)
-		err := json.Unmarshal([]byte(alertRule.RuleObject), &rulesGroup)
-		if err != nil {
-			fmt.Println("Error in rule evaluation ", err)
-		}
-		var alertMap map[string]interface{}
-		err1 := mapstructure.Decode(newAlert, &alertMap)
+		alertMap, err1 := alertToMap(newAlert)
 		if err1 != nil {
 			fmt.Println("ERROR : Unable to convert struct to map")
 		}
 		fmt.Println("THE ALERT MAP IS ", alertMap)
-		res := ruleengine.EvaluateRulesGroup(alertMap, rulesGroup)
+		res := evaluateRule("alert", alertRule.ID, alertRule.RuleName, alertMap, rulesGroup)
 		fmt.Printf("The Alert rule %v MATCH is %v \n", alertRule.RuleName , res)
 		if res {
-			if len(alertRule.SetField) == 0 {
-				fmt.Println("The Set feild is empty. Skipping")
-				continue
+			dropped := newAlert.AlertDropped
+			applyAlertRule(newAlert, alertRule)
+			if newAlert.AlertDropped != dropped {
+				recordRuleDrop(mongoClient, alertRule, newAlert.AlertDropped)
 			}
-			// Do the action specified in the rule
-			v := reflect.ValueOf(newAlert).Elem()
-			field := v.FieldByName(alertRule.SetField)
-			if !field.IsValid() ||  !field.CanSet()  {
-				fmt.Println("ERROR : The struct element is un settable")
-				continue
+			newAlert.RuleHistory = append(newAlert.RuleHistory, ruleHit("alert", alertRule.ID, alertRule.RuleName, alertRule.Revision))
+			if alertRule.StopProcessing || newAlert.AlertDropped == models.AlertDiscarded {
+				fmt.Printf("Alert rule %v stops processing of later rules\n", alertRule.RuleName)
+				break
 			}
-			fieldValue := reflect.ValueOf(alertRule.SetValue)
-			field.Set(fieldValue)
 		}
 		fmt.Println("The MATCH is ", res)
 	}
 	return true
 }
 
-func processTagRules(newAlert *models.DbAlert, mongoClient *mongo.Client) bool {
-	var rulesGroup ruleengine.RulesGroup
-	tagRulesCollection := mongoClient.Database(mongodatabase).Collection("tagrules")
-
-	cursor, err := tagRulesCollection.Find(context.TODO(), bson.D{})
-    if err != nil {
-        log.Fatal(err)
-    }
-    defer cursor.Close(context.TODO())
+// applyAlertRule performs the actions of a matched alert rule on the alert
+// and returns a description of each change made. The single SetField /
+// SetValue pair of older rules runs before the Actions list.
+func applyAlertRule(newAlert *models.DbAlert, alertRule models.DbAlertRule) []string {
+	actions := alertRule.Actions
+	if len(alertRule.SetField) != 0 {
+		actions = append([]models.RuleAction{{Type: models.ActionSet, Field: alertRule.SetField, Value: alertRule.SetValue}}, actions...)
+	}
+	if len(actions) == 0 {
+		fmt.Println("The rule has no actions. Skipping")
+		return nil
+	}
+	return applyRuleActions(newAlert, actions)
+}
 
-	var tagRules []models.DbTagRule
-	if err = cursor.All(context.TODO(), &tagRules); err != nil {
-        log.Fatal(err)
-    }
+func processTagRules(newAlert *models.DbAlert, mongoClient *mongo.Client) bool {
+	rules := currentRules(mongoClient)
 
-	for _, tagRule   := range tagRules {
+	for _, compiled := range rules.TagRules {
+		tagRule := compiled.Rule
+		rulesGroup := compiled.Group
 		fmt.Println("Rule is ", tagRule.RuleObject)
-		err := json.Unmarshal([]byte(tagRule.RuleObject), &rulesGroup)
-		if err != nil {
-			fmt.Println("Error in rule evaluation ", err)
-		}
-		var alertMap map[string]interface{}
-		err1 := mapstructure.Decode(newAlert, &alertMap)
+		alertMap, err1 := alertToMap(newAlert)
 		if err1 != nil {
 			fmt.Println("ERROR : Unable to convert struct to map")
 		}
 		fmt.Println("THE ALERT MAP IS ", alertMap)
-		res := ruleengine.EvaluateRulesGroup(alertMap, rulesGroup)
+		res := evaluateRule("tag", tagRule.ID, tagRule.RuleName, alertMap, rulesGroup)
 		fmt.Printf("The Tag rule %v MATCH is %v \n", tagRule.RuleName , res)
 		if res {
-			if len(tagRule.TagValue) != 0 {
-				fmt.Println("The Tag Value is NOT empty. setting tag ")
-				newAlert.AdditionalDetails[tagRule.TagName] = tagRule.TagValue
-				continue
+			applyTagRule(newAlert, compiled, false)
+			newAlert.RuleHistory = append(newAlert.RuleHistory, ruleHit("tag", tagRule.ID, tagRule.RuleName, tagRule.Revision))
+			if tagRule.StopProcessing {
+				fmt.Printf("Tag rule %v stops processing of later rules\n", tagRule.RuleName)
+				break
 			}
-			if len(tagRule.FieldExtraction) != 0 {
-				pattern := tagRule.FieldExtraction
-				re, err := regexp.Compile(pattern)
-				if err != nil {
-					fmt.Println("Error compiling regex:", err)
-					return false
-				}
-				// Do the action specified in the rule
-				v := reflect.ValueOf(newAlert).Elem()
-				field := v.FieldByName(tagRule.FieldName)
-				if !field.IsValid() ||  !field.CanSet()  {
-					fmt.Println("ERROR : The struct element is un settable")
-					continue
-				}
+		}
+		fmt.Println("The MATCH is ", res)
+	}
+	return true
+}
 
-				if re.MatchString(field.String()) {
-					// Extract the submatches
-					matches := re.FindStringSubmatch(field.String())
-					if len(matches) > 0 {
+// applyTagRule sets the tags of a matched tag rule and returns a description
+// of each tag set. TagValue is set as TagName after rendering its template
+// and ${path} placeholders against the alert; an empty result, or one that
+// references a tag the alert does not have, sets nothing.
+// Otherwise FieldExtraction is matched against FieldName, which may be an
+// alert field or a tag: the first capture group is set as TagName and every
+// named group (?P<name>...) is set as a tag of that name. With a LookupTable
+// the value of FieldName is looked up and every tag of the matching entry is
+// set. Errors of dry runs (tests, backtests) are not counted as rule errors.
+func applyTagRule(newAlert *models.DbAlert, compiled compiledTagRule, dryRun bool) []string {
+	tagRule := compiled.Rule
+	if newAlert.AdditionalDetails == nil {
+		newAlert.AdditionalDetails = make(map[string]interface{})
+	}
 
-						fmt.Printf("Entire match: '%s'\n", matches[0])
-						fmt.Printf("%s: '%s'\n",tagRule.TagName,  matches[1])
-						// Add the extracted tag name to the additional details.
-						newAlert.AdditionalDetails[tagRule.TagName] = matches[1]
-					}
-				}
+	alertMap, err := alertToMap(newAlert)
+	if err != nil {
+		fmt.Println("ERROR : Unable to convert struct to map")
+		return nil
+	}
+
+	if len(tagRule.TagValue) != 0 {
+		fmt.Println("The Tag Value is NOT empty. setting tag ")
+		value, err := utilities.RenderValue(tagRule.TagValue, newAlert, func(path string) (interface{}, bool) {
+			return ruleengine.ResolveField(alertMap, path)
+		})
+		if errors.Is(err, utilities.ErrMissingValue) {
+			return nil
+		}
+		if err != nil {
+			fmt.Printf("ERROR : tag rule %s value template failed: %v\n", tagRule.RuleName, err)
+			if !dryRun {
+				recordRuleError("tag", tagRule.RuleName, err)
 			}
+			return nil
 		}
-		fmt.Println("The MATCH is ", res)
+		if value == "" {
+			return nil
+		}
+		newAlert.AdditionalDetails[tagRule.TagName] = value
+		return []string{fmt.Sprintf("set tag %s = %q", tagRule.TagName, value)}
 	}
-	return true
+	if compiled.Regex == nil && compiled.Lookup == nil {
+		return nil
+	}
+	source, ok := ruleengine.ResolveField(alertMap, tagRule.FieldName)
+	if !ok || source == nil {
+		fmt.Printf("Tag rule %v: field %v not found on the alert\n", tagRule.RuleName, tagRule.FieldName)
+		return nil
+	}
+
+	if compiled.Lookup != nil {
+		tags, found := compiled.Lookup.lookup(fmt.Sprintf("%v", source))
+		if !found {
+			return nil
+		}
+		names := make([]string, 0, len(tags))
+		for name := range tags {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		var changes []string
+		for _, name := range names {
+			newAlert.AdditionalDetails[name] = tags[name]
+			changes = append(changes, fmt.Sprintf("set tag %s = %q (lookup %s in %s)", name, tags[name], tagRule.FieldName, tagRule.LookupTable))
+		}
+		return changes
+	}
+
+	// Extract the submatches
+	re := compiled.Regex
+	matches := re.FindStringSubmatch(fmt.Sprintf("%v", source))
+	if len(matches) < 2 {
+		return nil
+	}
+
+	var changes []string
+	setTag := func(name string, value string) {
+		newAlert.AdditionalDetails[name] = value
+		changes = append(changes, fmt.Sprintf("set tag %s = %q (extracted from %s)", name, value, tagRule.FieldName))
+	}
+	if tagRule.TagName != "" {
+		setTag(tagRule.TagName, matches[1])
+	}
+	for i, name := range re.SubexpNames() {
+		if name != "" && name != tagRule.TagName && matches[i] != "" {
+			setTag(name, matches[i])
+		}
+	}
+	return changes
 }
 
 func processGrouping(newAlert *models.DbAlert, mongoClient *mongo.Client) bool {
 	fmt.Println("Processing group rules")
-	alertGroupCollection := mongoClient.Database(mongodatabase).Collection("correlationrules")
 	alertCollection := mongoClient.Database(mongodatabase).Collection("alerts")
-	findOptions := options.Find()
-    findOptions.SetSort(bson.D{{Key: "groupwindow", Value: 1}})
-	cursor, err := alertGroupCollection.Find(context.TODO(), bson.D{},findOptions)
-    if err != nil {
-        log.Fatal(err)
-    }
-    defer cursor.Close(context.TODO())
-
-	var alertGroupConfigs []models.DbAlertGroup
-
-	if err = cursor.All(context.TODO(), &alertGroupConfigs); err != nil {
-        log.Fatal(err)
-    }
+	// Correlation rules are sorted by groupwindow in the rule snapshot
+	alertGroupConfigs := currentRules(mongoClient).CorrelationRules
 
 	for _, alertGroupConfig   := range alertGroupConfigs {
 
 		fmt.Println("The alertConfig is ", alertGroupConfig)
         
         if alertGroupConfig.CorrelationMode == "SIMILARITY" {
-             if processSimilarityRule(newAlert, alertGroupConfig, mongoClient) {
+             start := time.Now()
+             matched := processSimilarityRule(newAlert, alertGroupConfig, mongoClient)
+             recordRuleStats("correlation", alertGroupConfig.ID, alertGroupConfig.GroupName, matched, time.Since(start))
+             if matched {
                  return true
              }
         } else {
 		    // check if the alertPattern matches with the incomming event.
-		    if (patternFound(alertGroupConfig.GroupTags , maps.Keys( newAlert.AdditionalDetails))){
+		    start := time.Now()
+		    matched := patternFound(alertGroupConfig.GroupTags , maps.Keys( newAlert.AdditionalDetails))
+		    recordRuleStats("correlation", alertGroupConfig.ID, alertGroupConfig.GroupName, matched, time.Since(start))
+		    if (matched){
 			    // pattern is found in the incomming event
 			    // construct the identifier
 			    groupidentifier := ""
@@ -798,38 +951,40 @@ func objectIdToString(id primitive.ObjectID) string {
 func processNotifyRules(newAlert *models.DbAlert, mongoClient *mongo.Client) bool {
 	// PagerDuty configuration is loaded from environment variables (N8N_PD_CREATE_ENDPOINT, etc.)
 
-	var rulesGroup ruleengine.RulesGroup
-	notifyRulesCollection := mongoClient.Database(mongodatabase).Collection("notifyrules")
-
-	cursor, err := notifyRulesCollection.Find(context.TODO(), bson.D{})
-    if err != nil {
-        log.Fatal(err)
-    }
-    defer cursor.Close(context.TODO())
+	rules := currentRules(mongoClient)
 
-	var notifyRules []models.DbNotifyRule
-	if err = cursor.All(context.TODO(), &notifyRules); err != nil {
-        log.Fatal(err)
-    }
-
-	for _, notifyRule   := range notifyRules {
-		fmt.Println("Rule is ", notifyRule)
-		err := json.Unmarshal([]byte(notifyRule.RuleObject), &rulesGroup)
-		if err != nil {
-			fmt.Println("Error in rule evaluation ", err)
+	stopProcessing := false
+	for _, compiled := range rules.NotifyRules {
+		// Set by a matched rule with StopProcessing, checked here because the
+		// notify actions below leave the iteration with continue.
+		if stopProcessing {
+			fmt.Println("Notify rule processing stopped by an earlier rule")
+			break
 		}
-		var alertMap map[string]interface{}
-		err1 := mapstructure.Decode(newAlert, &alertMap)
+		notifyRule := compiled.Rule
+		rulesGroup := compiled.Group
+		fmt.Println("Rule is ", notifyRule)
+		alertMap, err1 := alertToMap(newAlert)
 		if err1 != nil {
 			fmt.Println("ERROR : Unable to convert struct to map")
 		}
 		fmt.Println("THE ALERT MAP IS ", alertMap)
-		res := ruleengine.EvaluateRulesGroup(alertMap, rulesGroup)
+		res := evaluateRule("notify", notifyRule.ID, notifyRule.RuleName, alertMap, rulesGroup)
 		fmt.Printf("The Notify rule %v MATCH is %v \n", notifyRule.RuleName , res)
 
 		if res {
 
 			newAlert.AlertDestination = notifyRule.RuleName
+			stopProcessing = notifyRule.StopProcessing
+
+			// The alert is already stored, so the hit is pushed to the document as well.
+			hit := ruleHit("notify", notifyRule.ID, notifyRule.RuleName, notifyRule.Revision)
+			newAlert.RuleHistory = append(newAlert.RuleHistory, hit)
+			_, err := mongoClient.Database(mongodatabase).Collection(mongocollection).UpdateOne(context.TODO(),
+				bson.M{"_id": newAlert.ID}, bson.M{"$push": bson.M{"rulehistory": hit}})
+			if err != nil {
+				fmt.Println("Error recording notify rule on alert:", err)
+			}
 
 		// Check if this alert is a CHILD alert (grouped but not a parent)
 		// Parent alerts should create PagerDuty incidents
@@ -879,6 +1034,7 @@ func processNotifyRules(newAlert *models.DbAlert, mongoClient *mongo.Client) boo
 		// Create a payload that includes both alert data and PagerDuty fields from the notification rule
 		payload := map[string]interface{}{
 			"alert": newAlert,
+			"runbooks": newAlert.Runbooks,
 			"pagerduty_service": notifyRule.PagerDutyService,
 			"pagerduty_escalation_policy": notifyRule.PagerDutyEscalationPolicy,
 		}
@@ -1,9 +1,13 @@
 package models
 
 import (
+	"errors"
+	"fmt"
 	"strings"
 	"time"
 
+	"alertmanager/ruleengine"
+
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
@@ -58,18 +62,23 @@ type DbAlert struct {
 	PagerDutyHtmlUrl	string			`json:"pagerduty_html_url,omitempty" bson:"pagerduty_html_url,omitempty"`
 	PagerDutyService	string			`json:"pagerduty_service,omitempty" bson:"pagerduty_service,omitempty"`
 	PagerDutyEscalationPolicy	string	`json:"pagerduty_escalation_policy,omitempty" bson:"pagerduty_escalation_policy,omitempty"`
+	RuleHistory		[]RuleHit			`json:"rulehistory,omitempty" bson:"rulehistory,omitempty"`
+	Runbooks		[]AlertRunbook		`json:"runbooks,omitempty" bson:"runbooks,omitempty"`
 }
 
 
 
 type DbAlertRule struct {
-	ID 					primitive.ObjectID `bson:"_id,omitempty"`
+	ID 					primitive.ObjectID `bson:"_id,omitempty" json:"_id"`
 	RuleName			string 				`json:"ruleName"`
 	RuleDescription 	string 				`json:"ruleDescription"`
 	RuleObject			string  			`json:"ruleObject"`
 	Order				int  				`json:"order"`
 	SetField			string				`json:"setField"`
 	SetValue			string				`json:"setValue"`
+	Actions				[]RuleAction		`json:"actions"`
+	StopProcessing		bool				`json:"stopProcessing"`
+	Revision			int					`json:"revision"`
 }
 
 type WorkLog struct {
@@ -77,4 +86,37 @@ type WorkLog struct {
     Author    string             `bson:"author" json:"author"`
     Comment   string             `bson:"comment" json:"comment"`
     CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
-}
\ No newline at end of file
+}
+
+// SettableAlertFields are the DbAlert fields an alert rule may set.
+var SettableAlertFields = []string{
+	"Entity", "AlertSource", "ServiceName", "AlertSummary", "AlertNotes", "AlertAcked",
+	"Severity", "AlertPriority", "IpAddress", "AlertType", "AlertDropped", "AlertDestination",
+}
+
+func (r *DbAlertRule) Validate() error {
+	if r.RuleName == "" {
+		return errors.New("ruleName is required")
+	}
+	if err := ruleengine.ValidateRuleObject(r.RuleObject); err != nil {
+		return err
+	}
+	if r.SetField != "" && !isSettableAlertField(r.SetField) {
+		return fmt.Errorf("setField %q is not a settable alert field", r.SetField)
+	}
+	for i := range r.Actions {
+		if err := r.Actions[i].Validate(); err != nil {
+			return fmt.Errorf("action %d (%s): %v", i+1, r.Actions[i].Type, err)
+		}
+	}
+	return nil
+}
+
+func isSettableAlertField(field string) bool {
+	for _, f := range SettableAlertFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CMDB lifecycle states.
+const (
+	LifecyclePlanned        = "planned"
+	LifecycleActive         = "active"
+	LifecycleMaintenance    = "maintenance"
+	LifecycleDecommissioned = "decommissioned"
+)
+
+// CmdbEntity is an entry of the local entity inventory used to enrich alerts
+// whose entity is not in the topology graph. Alerts match an entity by its
+// name, one of its aliases or one of its IPs, case-insensitively.
+type CmdbEntity struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"_id"`
+	Name        string             `bson:"name" json:"name"`
+	Aliases     []string           `bson:"aliases" json:"aliases"`
+	IPs         []string           `bson:"ips" json:"ips"`
+	Owner       string             `bson:"owner" json:"owner"`
+	Environment string             `bson:"environment" json:"environment"`
+	Criticality string             `bson:"criticality" json:"criticality"`
+	Lifecycle   string             `bson:"lifecycle" json:"lifecycle"`
+	UpdatedAt   time.Time          `bson:"updatedat" json:"updatedat"`
+	// Keys holds the lower-cased name, aliases and IPs for indexed matching.
+	Keys []string `bson:"keys" json:"-"`
+}
+
+func (e *CmdbEntity) Validate() error {
+	if strings.TrimSpace(e.Name) == "" {
+		return errors.New("name is required")
+	}
+	for _, ip := range e.IPs {
+		if net.ParseIP(ip) == nil {
+			return fmt.Errorf("invalid ip %q", ip)
+		}
+	}
+	switch e.Lifecycle {
+	case "", LifecyclePlanned, LifecycleActive, LifecycleMaintenance, LifecycleDecommissioned:
+	default:
+		return fmt.Errorf("lifecycle must be one of %s, %s, %s or %s", LifecyclePlanned, LifecycleActive, LifecycleMaintenance, LifecycleDecommissioned)
+	}
+	return nil
+}
+
+// Normalize trims the entity's fields and computes its match keys.
+func (e *CmdbEntity) Normalize() {
+	e.Name = strings.TrimSpace(e.Name)
+	e.Aliases = trimmedList(e.Aliases)
+	e.IPs = trimmedList(e.IPs)
+	e.Lifecycle = strings.ToLower(strings.TrimSpace(e.Lifecycle))
+
+	e.Keys = []string{}
+	seen := make(map[string]bool)
+	for _, key := range append(append([]string{e.Name}, e.Aliases...), e.IPs...) {
+		if key = strings.ToLower(key); !seen[key] {
+			seen[key] = true
+			e.Keys = append(e.Keys, key)
+		}
+	}
+}
+
+func trimmedList(values []string) []string {
+	trimmed := []string{}
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			trimmed = append(trimmed, value)
+		}
+	}
+	return trimmed
+}
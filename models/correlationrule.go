@@ -1,20 +1,57 @@
 package models
 
 import (
+	"errors"
+	"fmt"
+
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// Correlation modes. Any mode other than SIMILARITY groups by GroupTags.
+const (
+	CorrelationModeTags       = "TAGS"
+	CorrelationModeSimilarity = "SIMILARITY"
+)
+
 type DbAlertGroup struct {
-	ID 					primitive.ObjectID 	`bson:"_id,omitempty"`
+	ID 					primitive.ObjectID 	`bson:"_id,omitempty" json:"_id"`
 	GroupName			string 				`bson:"groupname" json:"groupname"`
 	GroupTags 			[]string 			`bson:"grouptags" json:"grouptags"`
 	GroupWindow			int  				`bson:"groupwindow" json:"groupwindow"`
 	ScopeTags           []string            `bson:"scope_tags" json:"scope_tags"`
 	CorrelationMode     string              `bson:"correlation_mode" json:"correlation_mode"`
 	Similarity          SimilarityConfig    `bson:"similarity" json:"similarity"`
+	Revision            int                 `bson:"revision" json:"revision"`
 }
 
 type SimilarityConfig struct {
 	Fields    []string `bson:"fields" json:"fields"`
 	Threshold float64  `bson:"threshold" json:"threshold"`
-}
\ No newline at end of file
+}
+
+func (g *DbAlertGroup) Validate() error {
+	if g.GroupName == "" {
+		return errors.New("groupname is required")
+	}
+	if g.GroupWindow <= 0 {
+		return errors.New("groupwindow must be a positive number of seconds")
+	}
+
+	switch g.CorrelationMode {
+	case CorrelationModeSimilarity:
+		if len(g.Similarity.Fields) == 0 {
+			return errors.New("similarity.fields is required for SIMILARITY correlation")
+		}
+		// A threshold of 0 falls back to the default of 0.8.
+		if g.Similarity.Threshold < 0 || g.Similarity.Threshold > 1 {
+			return fmt.Errorf("similarity.threshold must be between 0 and 1, got %v", g.Similarity.Threshold)
+		}
+	case "", CorrelationModeTags:
+		if len(g.GroupTags) == 0 {
+			return errors.New("grouptags is required for tag correlation")
+		}
+	default:
+		return fmt.Errorf("invalid correlation_mode %q", g.CorrelationMode)
+	}
+	return nil
+}
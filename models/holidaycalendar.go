@@ -0,0 +1,31 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// HolidayCalendar is a named list of dates that schedule rule conditions can
+// refer to, e.g. {"calendar": "uk-bank-holidays"}.
+type HolidayCalendar struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"_id"`
+	Name        string             `bson:"name" json:"name"`
+	Description string             `bson:"description" json:"description"`
+	Dates       []string           `bson:"dates" json:"dates"` // 2006-01-02
+	Revision    int                `bson:"revision" json:"revision"`
+}
+
+func (c *HolidayCalendar) Validate() error {
+	if c.Name == "" {
+		return errors.New("name is required")
+	}
+	for _, date := range c.Dates {
+		if _, err := time.Parse("2006-01-02", date); err != nil {
+			return fmt.Errorf("invalid date %q, expected YYYY-MM-DD", date)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"path"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// LookupTable maps keys to sets of tags for lookup tag rules. A key is
+// matched exactly, as a prefix when it ends in a single "*" (e.g. "web-*"),
+// or as a wildcard pattern with "*" and "?" anywhere (e.g. "db-??-prod").
+// Exact keys win over prefixes, longer prefixes over shorter ones and
+// prefixes over wildcards. Default applies when nothing matches; a "*" key
+// is the same as Default.
+type LookupTable struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"_id"`
+	Name        string             `bson:"name" json:"name"`
+	Description string             `bson:"description" json:"description"`
+	IgnoreCase  bool               `bson:"ignorecase" json:"ignorecase"`
+	Entries     []LookupEntry      `bson:"entries" json:"entries"`
+	Default     map[string]string  `bson:"default" json:"default"`
+	Revision    int                `bson:"revision" json:"revision"`
+}
+
+// LookupEntry is one key of a lookup table with the tags it sets.
+type LookupEntry struct {
+	Key  string            `bson:"key" json:"key"`
+	Tags map[string]string `bson:"tags" json:"tags"`
+}
+
+func (t *LookupTable) Validate() error {
+	if t.Name == "" {
+		return errors.New("name is required")
+	}
+	seen := make(map[string]bool, len(t.Entries))
+	for _, entry := range t.Entries {
+		if entry.Key == "" {
+			return errors.New("entry key is required")
+		}
+		if seen[entry.Key] {
+			return fmt.Errorf("duplicate entry key %q", entry.Key)
+		}
+		seen[entry.Key] = true
+		if len(entry.Tags) == 0 {
+			return fmt.Errorf("entry %q sets no tags", entry.Key)
+		}
+		if _, err := path.Match(entry.Key, ""); err != nil {
+			return fmt.Errorf("invalid entry key %q: %v", entry.Key, err)
+		}
+	}
+	return nil
+}
@@ -1,11 +1,15 @@
 package models
 
 import (
+	"errors"
+
+	"alertmanager/ruleengine"
+
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type DbNotifyRule struct {
-	ID 					primitive.ObjectID `bson:"_id,omitempty"`
+	ID 					primitive.ObjectID `bson:"_id,omitempty" json:"_id"`
 	RuleName			string 				`bson:"rulename" json:"rulename"`
 	RuleDescription 	string 				`bson:"ruledescription" json:"ruledescription"`
 	RuleObject			string  			`bson:"ruleobject" json:"ruleobject"`
@@ -14,5 +18,13 @@ type DbNotifyRule struct {
 	EndPoint			string 				`bson:"endpoint" json:"endpoint"`
 	PagerDutyService		string				`bson:"pagerduty_service,omitempty" json:"pagerduty_service,omitempty"`
 	PagerDutyEscalationPolicy	string			`bson:"pagerduty_escalation_policy,omitempty" json:"pagerduty_escalation_policy,omitempty"`
+	StopProcessing		bool				`bson:"stopprocessing" json:"stopprocessing"`
+	Revision			int					`bson:"revision" json:"revision"`
 }
 
+func (r *DbNotifyRule) Validate() error {
+	if r.RuleName == "" {
+		return errors.New("rulename is required")
+	}
+	return ruleengine.ValidateRuleObject(r.RuleObject)
+}
@@ -0,0 +1,77 @@
+package models
+
+import (
+	"fmt"
+
+	"alertmanager/utilities"
+)
+
+// Alert rule action types.
+const (
+	ActionSet           = "set"
+	ActionSetTag        = "setTag"
+	ActionRemoveTag     = "removeTag"
+	ActionSetPriority   = "setPriority"
+	ActionRaisePriority = "raisePriority"
+	ActionLowerPriority = "lowerPriority"
+	ActionAppendNote    = "appendNote"
+	ActionDrop          = "drop"
+	ActionDiscard       = "discard"
+)
+
+// AlertDropped values. A dropped alert is stored for audit but neither
+// grouped nor notified; a discarded alert is not stored at all.
+const (
+	AlertDroppedYes = "YES"
+	AlertDiscarded  = "DISCARDED"
+)
+
+// RuleAction is one change an alert rule makes to a matching alert. Value may
+// be a template referencing other alert fields, e.g. "{{.Entity}}" or
+// "{{.AdditionalDetails.region}}".
+type RuleAction struct {
+	Type  string `bson:"type" json:"type"`
+	Field string `bson:"field,omitempty" json:"field,omitempty"` // set
+	Tag   string `bson:"tag,omitempty" json:"tag,omitempty"`     // setTag, removeTag
+	Value string `bson:"value,omitempty" json:"value,omitempty"` // set, setTag, setPriority, appendNote
+	Steps int    `bson:"steps,omitempty" json:"steps,omitempty"` // raisePriority, lowerPriority; defaults to 1
+}
+
+func (a *RuleAction) Validate() error {
+	switch a.Type {
+	case ActionSet:
+		if !isSettableAlertField(a.Field) {
+			return fmt.Errorf("field %q is not a settable alert field", a.Field)
+		}
+	case ActionSetTag:
+		if a.Tag == "" {
+			return fmt.Errorf("tag is required")
+		}
+	case ActionRemoveTag:
+		if a.Tag == "" {
+			return fmt.Errorf("tag is required")
+		}
+	case ActionSetPriority:
+		if !utilities.IsPriority(a.Value) && !utilities.IsTemplate(a.Value) {
+			return fmt.Errorf("priority %q must be one of P0 to P4 or a template", a.Value)
+		}
+	case ActionAppendNote:
+		if a.Value == "" {
+			return fmt.Errorf("value is required")
+		}
+	case ActionRaisePriority, ActionLowerPriority:
+		if a.Steps < 0 {
+			return fmt.Errorf("steps must not be negative")
+		}
+	case ActionDrop, ActionDiscard:
+	default:
+		return fmt.Errorf("unknown action type %q", a.Type)
+	}
+
+	if utilities.IsTemplate(a.Value) {
+		if _, err := utilities.ParseTemplate(a.Value); err != nil {
+			return fmt.Errorf("invalid value template: %v", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Actions recorded on a rule revision.
+const (
+	RevisionActionBaseline = "baseline"
+	RevisionActionCreate   = "create"
+	RevisionActionUpdate   = "update"
+	RevisionActionDelete   = "delete"
+	RevisionActionRollback = "rollback"
+)
+
+// RuleRevision is a stored copy of a rule as it was after a change. Rule holds
+// the full rule document of the given kind (alertrules, tagrules, ...).
+type RuleRevision struct {
+	ID        primitive.ObjectID `json:"_id" bson:"_id,omitempty"`
+	RuleKind  string             `bson:"rulekind" json:"rulekind"`
+	RuleID    primitive.ObjectID `bson:"ruleid" json:"ruleid"`
+	Revision  int                `bson:"revision" json:"revision"`
+	Action    string             `bson:"action" json:"action"`
+	Author    string             `bson:"author" json:"author"`
+	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
+	Rule      bson.M             `bson:"rule" json:"rule"`
+}
+
+// RuleHit records a rule revision that matched and acted on an alert.
+type RuleHit struct {
+	RuleKind  string             `bson:"rulekind" json:"rulekind"`
+	RuleID    primitive.ObjectID `bson:"ruleid" json:"ruleid"`
+	RuleName  string             `bson:"rulename" json:"rulename"`
+	Revision  int                `bson:"revision" json:"revision"`
+	MatchedAt time.Time          `bson:"matchedAt" json:"matchedAt"`
+}
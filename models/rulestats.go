@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// RuleStats holds the persisted counters of a rule, keyed by the rule's id.
+type RuleStats struct {
+	ID              primitive.ObjectID `json:"_id" bson:"_id"`
+	RuleKind        string             `bson:"rulekind" json:"rulekind"`
+	RuleName        string             `bson:"rulename" json:"rulename"`
+	Evaluations     int64              `bson:"evaluations" json:"evaluations"`
+	Matches         int64              `bson:"matches" json:"matches"`
+	DurationNs      int64              `bson:"durationNs" json:"durationNs"` // cumulative evaluation time
+	LastEvaluatedAt time.Time          `bson:"lastEvaluatedAt,omitempty" json:"lastEvaluatedAt,omitempty"`
+	LastMatchedAt   time.Time          `bson:"lastMatchedAt,omitempty" json:"lastMatchedAt,omitempty"`
+	Dropped         int64              `bson:"dropped" json:"dropped"`
+	Discarded       int64              `bson:"discarded" json:"discarded"`
+	LastDroppedAt   time.Time          `bson:"lastDroppedAt,omitempty" json:"lastDroppedAt,omitempty"`
+}
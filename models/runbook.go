@@ -0,0 +1,70 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+
+	"alertmanager/ruleengine"
+	"alertmanager/utilities"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Runbook is an entry of the runbook registry. Every runbook whose
+// RuleObject matches a new alert is attached to it. URL and Instructions may
+// be templates rendered against the alert, e.g. "https://wiki/runbooks/{{.ServiceName}}".
+type Runbook struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"_id"`
+	Name         string             `bson:"name" json:"name"`
+	Description  string             `bson:"description" json:"description"`
+	RuleObject   string             `bson:"ruleobject" json:"ruleobject"`
+	Order        int                `bson:"order" json:"order"`
+	URL          string             `bson:"url" json:"url"`
+	Instructions string             `bson:"instructions" json:"instructions"`
+	Revision     int                `bson:"revision" json:"revision"`
+}
+
+// AlertRunbook is a runbook as attached to an alert.
+type AlertRunbook struct {
+	RunbookID    primitive.ObjectID `json:"runbookid" bson:"runbookid"`
+	Name         string             `json:"name" bson:"name"`
+	URL          string             `json:"url,omitempty" bson:"url,omitempty"`
+	Instructions string             `json:"instructions,omitempty" bson:"instructions,omitempty"`
+}
+
+func (r *Runbook) Validate() error {
+	if r.Name == "" {
+		return errors.New("name is required")
+	}
+	if err := ruleengine.ValidateRuleObject(r.RuleObject); err != nil {
+		return err
+	}
+	if r.URL == "" && r.Instructions == "" {
+		return errors.New("either url or instructions is required")
+	}
+	if r.URL != "" && !utilities.IsTemplate(r.URL) {
+		if err := CheckRunbookURL(r.URL); err != nil {
+			return err
+		}
+	}
+	for name, text := range map[string]string{"url": r.URL, "instructions": r.Instructions} {
+		if utilities.IsTemplate(text) {
+			if _, err := utilities.ParseTemplate(text); err != nil {
+				return fmt.Errorf("invalid %s template: %v", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// CheckRunbookURL accepts absolute http and https URLs only, so a runbook link
+// can never be a javascript: or otherwise unsafe URL. Templated URLs are
+// checked again once rendered.
+func CheckRunbookURL(link string) error {
+	parsed, err := url.Parse(link)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("invalid url %q, an http or https url is required", link)
+	}
+	return nil
+}
@@ -1,11 +1,18 @@
 package models
 
 import (
+	"errors"
+	"fmt"
+	"regexp"
+
+	"alertmanager/ruleengine"
+	"alertmanager/utilities"
+
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type DbTagRule struct {
-	ID 					primitive.ObjectID 	`bson:"_id,omitempty"`
+	ID 					primitive.ObjectID 	`bson:"_id,omitempty" json:"_id"`
 	RuleName			string 				`bson:"rulename" json:"rulename"`
 	RuleDescription 	string 				`bson:"ruledescription" json:"ruledescription"`
 	RuleObject			string  			`bson:"ruleobject" json:"ruleobject"`
@@ -13,5 +20,51 @@ type DbTagRule struct {
 	FieldName			string				`bson:"fieldname" json:"fieldname"`
 	TagName				string 				`bson:"tagname" json:"tagname"`
 	FieldExtraction		string				`bson:"fieldextraction" json:"fieldextraction"`
-	TagValue			string 				`bson:"tagvalue" json:"tagvalue"`
-}
\ No newline at end of file
+	TagValue			string 				`bson:"tagvalue" json:"tagvalue"` // may be a template, e.g. "{{lower .ServiceName}}-${region}"
+	LookupTable			string				`bson:"lookuptable" json:"lookuptable"` // name of a lookup table keyed by FieldName
+	StopProcessing		bool				`bson:"stopprocessing" json:"stopprocessing"`
+	Revision			int					`bson:"revision" json:"revision"`
+}
+
+func (r *DbTagRule) Validate() error {
+	if r.RuleName == "" {
+		return errors.New("rulename is required")
+	}
+	if err := ruleengine.ValidateRuleObject(r.RuleObject); err != nil {
+		return err
+	}
+	if r.TagValue == "" && r.FieldExtraction == "" && r.LookupTable == "" {
+		return errors.New("one of tagvalue, fieldextraction or lookuptable is required")
+	}
+	if r.LookupTable != "" && r.FieldName == "" {
+		return errors.New("fieldname is required with lookuptable")
+	}
+	if r.TagValue != "" && r.TagName == "" {
+		return errors.New("tagname is required with tagvalue")
+	}
+	if utilities.IsTemplate(r.TagValue) {
+		if _, err := utilities.ParseTemplate(r.TagValue); err != nil {
+			return fmt.Errorf("invalid tagvalue template: %v", err)
+		}
+	}
+	if r.FieldExtraction != "" {
+		if r.FieldName == "" {
+			return errors.New("fieldname is required with fieldextraction")
+		}
+		re, err := regexp.Compile(r.FieldExtraction)
+		if err != nil {
+			return fmt.Errorf("invalid fieldextraction: %v", err)
+		}
+		if re.NumSubexp() == 0 {
+			return errors.New("fieldextraction needs at least one capture group")
+		}
+		named := false
+		for _, name := range re.SubexpNames() {
+			named = named || name != ""
+		}
+		if r.TagName == "" && !named {
+			return errors.New("tagname is required unless fieldextraction has named groups")
+		}
+	}
+	return nil
+}
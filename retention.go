@@ -0,0 +1,407 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"alertmanager/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Retention configuration, loaded from the environment:
+//
+//	ALERT_RETENTION_DAYS              age in days after which CLOSED alerts are archived (0 disables)
+//	ALERT_RETENTION_INTERVAL_MINUTES  how often the retention job runs (default 60)
+//	ALERT_ARCHIVE_MODE                "collection" (default) or "file"
+//	ALERT_ARCHIVE_COLLECTION          archive collection name (default <MONGO_COLLECTION>_archive)
+//	ALERT_ARCHIVE_DIR                 directory for compressed NDJSON archives in file mode
+var alertRetentionDays = envInt("ALERT_RETENTION_DAYS", 0)
+var alertRetentionInterval = envInt("ALERT_RETENTION_INTERVAL_MINUTES", 60)
+var alertArchiveMode = envString("ALERT_ARCHIVE_MODE", "collection")
+var alertArchiveCollection = envString("ALERT_ARCHIVE_COLLECTION", mongocollection+"_archive")
+var alertArchiveDir = envString("ALERT_ARCHIVE_DIR", "archive")
+
+// retentionBatchSize is the number of top level alerts archived per batch.
+const retentionBatchSize = 200
+
+// retentionMutex prevents the scheduled and manually triggered runs from
+// archiving the same alerts concurrently.
+var retentionMutex sync.Mutex
+
+type RetentionResult struct {
+	Cutoff      time.Time `json:"cutoff"`
+	Mode        string    `json:"mode"`
+	Archived    int       `json:"archived"`
+	Skipped     int       `json:"skipped"`
+	ArchiveFile string    `json:"archive_file,omitempty"`
+	DurationMs  int64     `json:"duration_ms"`
+}
+
+func envString(key string, def string) string {
+	if val := os.Getenv(key); val != "" {
+		return val
+	}
+	return def
+}
+
+func envInt(key string, def int) int {
+	if val, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return val
+	}
+	return def
+}
+
+// StartRetentionWorker runs the retention job periodically when a retention
+// age is configured.
+func StartRetentionWorker(mongoClient *mongo.Client) {
+	if alertRetentionDays <= 0 {
+		fmt.Println("Alert retention disabled (ALERT_RETENTION_DAYS not set)")
+		return
+	}
+	interval := time.Duration(alertRetentionInterval) * time.Minute
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	fmt.Printf("Alert retention enabled: archiving CLOSED alerts older than %d days every %v (%s mode)\n", alertRetentionDays, interval, alertArchiveMode)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for ; ; <-ticker.C {
+			result, err := RunRetention(context.Background(), mongoClient, alertRetentionDays)
+			if err != nil {
+				fmt.Println("Error running alert retention:", err)
+				continue
+			}
+			fmt.Printf("Alert retention archived %d alerts (skipped %d)\n", result.Archived, result.Skipped)
+		}
+	}()
+}
+
+// RunRetention moves CLOSED alerts whose clear time is older than the given
+// number of days out of the alerts collection. A parent incident is only
+// archived together with all of its children, and only once every child is
+// itself closed and past the cutoff.
+func RunRetention(ctx context.Context, mongoClient *mongo.Client, days int) (RetentionResult, error) {
+	retentionMutex.Lock()
+	defer retentionMutex.Unlock()
+
+	start := time.Now()
+	result := RetentionResult{
+		Cutoff: start.AddDate(0, 0, -days),
+		Mode:   alertArchiveMode,
+	}
+
+	alertCollection := mongoClient.Database(mongodatabase).Collection(mongocollection)
+
+	var sink archiveSink
+	switch alertArchiveMode {
+	case "collection":
+		sink = &collectionArchiveSink{collection: mongoClient.Database(mongodatabase).Collection(alertArchiveCollection)}
+	case "file":
+		fileSink, err := newFileArchiveSink(alertArchiveDir, start)
+		if err != nil {
+			return result, err
+		}
+		sink = fileSink
+		result.ArchiveFile = fileSink.path
+	default:
+		return result, fmt.Errorf("invalid ALERT_ARCHIVE_MODE %q", alertArchiveMode)
+	}
+
+	// Top level alerts: parents and standalone alerts.
+	topLevel := bson.M{
+		"alertstatus":         "CLOSED",
+		"alertcleartime.time": bson.M{"$lt": result.Cutoff},
+		"grouped":             bson.M{"$ne": true},
+	}
+	archived, skipped, err := archiveMatching(ctx, alertCollection, sink, topLevel, result.Cutoff, false)
+	result.Archived += archived
+	result.Skipped += skipped
+	if err != nil {
+		sink.Close()
+		return result, err
+	}
+
+	// Children whose parent no longer exists would otherwise never be archived.
+	orphans := bson.M{
+		"alertstatus":         "CLOSED",
+		"alertcleartime.time": bson.M{"$lt": result.Cutoff},
+		"grouped":             true,
+	}
+	archived, skipped, err = archiveMatching(ctx, alertCollection, sink, orphans, result.Cutoff, true)
+	result.Archived += archived
+	result.Skipped += skipped
+
+	if closeErr := sink.Close(); err == nil {
+		err = closeErr
+	}
+	result.DurationMs = time.Since(start).Milliseconds()
+	return result, err
+}
+
+// archiveMatching archives the alerts matching filter in batches. When
+// orphansOnly is set, alerts are only archived if their parent is gone.
+func archiveMatching(ctx context.Context, collection *mongo.Collection, sink archiveSink, filter bson.M, cutoff time.Time, orphansOnly bool) (int, int, error) {
+	archived, skipped := 0, 0
+
+	cursor, err := collection.Find(ctx, filter, options.Find().SetBatchSize(retentionBatchSize))
+	if err != nil {
+		return 0, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var batch []bson.Raw
+	var batchIDs []primitive.ObjectID
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		// Archive first, then delete, so a failure never loses alerts.
+		if err := sink.Write(ctx, batch); err != nil {
+			return err
+		}
+		deleteResult, err := collection.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": batchIDs}})
+		if err != nil {
+			return err
+		}
+		archived += int(deleteResult.DeletedCount)
+		batch, batchIDs = nil, nil
+		return nil
+	}
+
+	for cursor.Next(ctx) {
+		var alert models.DbAlert
+		if err := cursor.Decode(&alert); err != nil {
+			fmt.Println("Error decoding alert for retention:", err)
+			continue
+		}
+		raw := make(bson.Raw, len(cursor.Current))
+		copy(raw, cursor.Current)
+
+		if orphansOnly {
+			if parentExists(ctx, collection, alert.GroupIncidentId) {
+				continue
+			}
+			batch = append(batch, raw)
+			batchIDs = append(batchIDs, alert.ID)
+		} else {
+			children, ok := archivableChildren(ctx, collection, alert, cutoff)
+			if !ok {
+				skipped++
+				continue
+			}
+			batch = append(batch, raw)
+			batchIDs = append(batchIDs, alert.ID)
+			for _, child := range children {
+				batch = append(batch, child.raw)
+				batchIDs = append(batchIDs, child.id)
+			}
+		}
+
+		if len(batch) >= retentionBatchSize {
+			if err := flush(); err != nil {
+				return archived, skipped, err
+			}
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return archived, skipped, err
+	}
+	return archived, skipped, flush()
+}
+
+type archivedChild struct {
+	id  primitive.ObjectID
+	raw bson.Raw
+}
+
+// archivableChildren returns the children of a parent incident, or false if
+// any of them is still open or too recent to be archived with it.
+func archivableChildren(ctx context.Context, collection *mongo.Collection, parent models.DbAlert, cutoff time.Time) ([]archivedChild, bool) {
+	if len(parent.GroupAlerts) == 0 {
+		return nil, true
+	}
+
+	cursor, err := collection.Find(ctx, bson.M{"_id": bson.M{"$in": parent.GroupAlerts}})
+	if err != nil {
+		fmt.Println("Error finding children for retention:", err)
+		return nil, false
+	}
+	defer cursor.Close(ctx)
+
+	var children []archivedChild
+	for cursor.Next(ctx) {
+		var child models.DbAlert
+		if err := cursor.Decode(&child); err != nil {
+			fmt.Println("Error decoding child for retention:", err)
+			return nil, false
+		}
+		if child.AlertStatus != "CLOSED" || !child.AlertClearTime.Before(cutoff) {
+			return nil, false
+		}
+		raw := make(bson.Raw, len(cursor.Current))
+		copy(raw, cursor.Current)
+		children = append(children, archivedChild{id: child.ID, raw: raw})
+	}
+	return children, cursor.Err() == nil
+}
+
+func parentExists(ctx context.Context, collection *mongo.Collection, groupIncidentId string) bool {
+	parentID, err := primitive.ObjectIDFromHex(groupIncidentId)
+	if err != nil {
+		return false
+	}
+	count, err := collection.CountDocuments(ctx, bson.M{"_id": parentID})
+	// On error assume the parent exists so the child is left alone.
+	return err != nil || count > 0
+}
+
+// archiveSink is where archived alerts are written before they are deleted
+// from the alerts collection.
+type archiveSink interface {
+	Write(ctx context.Context, docs []bson.Raw) error
+	Close() error
+}
+
+type collectionArchiveSink struct {
+	collection *mongo.Collection
+}
+
+func (c *collectionArchiveSink) Write(ctx context.Context, docs []bson.Raw) error {
+	items := make([]interface{}, len(docs))
+	for i, doc := range docs {
+		items[i] = doc
+	}
+	_, err := c.collection.InsertMany(ctx, items, options.InsertMany().SetOrdered(false))
+	var bulkErr mongo.BulkWriteException
+	if !errors.As(err, &bulkErr) || bulkErr.WriteConcernError != nil {
+		return err
+	}
+	// Documents already archived by an interrupted earlier run are fine, any
+	// other failed insert must stop the batch from being deleted.
+	for _, writeErr := range bulkErr.WriteErrors {
+		if writeErr.Code != 11000 {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *collectionArchiveSink) Close() error {
+	return nil
+}
+
+// fileArchiveSink writes archived alerts as gzip compressed NDJSON (relaxed
+// extended JSON, one alert per line).
+type fileArchiveSink struct {
+	path string
+	file *os.File
+	gz   *gzip.Writer
+}
+
+func newFileArchiveSink(dir string, now time.Time) (*fileArchiveSink, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, fmt.Sprintf("alerts-%s.ndjson.gz", now.Format("20060102-150405")))
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &fileArchiveSink{path: path, file: file, gz: gzip.NewWriter(file)}, nil
+}
+
+func (f *fileArchiveSink) Write(ctx context.Context, docs []bson.Raw) error {
+	for _, doc := range docs {
+		line, err := bson.MarshalExtJSON(doc, false, false)
+		if err != nil {
+			return err
+		}
+		if _, err := f.gz.Write(append(line, '\n')); err != nil {
+			return err
+		}
+	}
+	// Make sure the batch is on disk before the alerts are deleted.
+	if err := f.gz.Flush(); err != nil {
+		return err
+	}
+	return f.file.Sync()
+}
+
+func (f *fileArchiveSink) Close() error {
+	if err := f.gz.Close(); err != nil {
+		f.file.Close()
+		return err
+	}
+	return f.file.Close()
+}
+
+// alertQueryCollections returns the collections an alert query should read,
+// based on the archive query parameter: "" (live alerts only), "include"
+// (live alerts and the archive) or "only" (archive only). Archives written
+// in file mode are not queryable, so asking for them is an error rather than
+// a silently incomplete result.
+func alertQueryCollections(mongoClient *mongo.Client, archive string) ([]*mongo.Collection, error) {
+	db := mongoClient.Database(mongodatabase)
+	switch archive {
+	case "", "false":
+		return []*mongo.Collection{db.Collection(mongocollection)}, nil
+	}
+	if alertArchiveMode == "file" {
+		return nil, fmt.Errorf("archive is not queryable in file mode")
+	}
+	switch archive {
+	case "include", "true":
+		return []*mongo.Collection{db.Collection(mongocollection), db.Collection(alertArchiveCollection)}, nil
+	case "only":
+		return []*mongo.Collection{db.Collection(alertArchiveCollection)}, nil
+	}
+	return nil, fmt.Errorf("invalid archive %q, use include or only", archive)
+}
+
+func RetentionHandler(w http.ResponseWriter, r *http.Request, mongoClient *mongo.Client) {
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"retention_days":     alertRetentionDays,
+			"interval_minutes":   alertRetentionInterval,
+			"archive_mode":       alertArchiveMode,
+			"archive_collection": alertArchiveCollection,
+			"archive_dir":        alertArchiveDir,
+		})
+	case http.MethodPost:
+		days := alertRetentionDays
+		if val, err := strconv.Atoi(r.URL.Query().Get("days")); err == nil {
+			days = val
+		}
+		if days <= 0 {
+			http.Error(w, "Retention age not configured, set ALERT_RETENTION_DAYS or pass days", http.StatusBadRequest)
+			return
+		}
+		result, err := RunRetention(r.Context(), mongoClient, days)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Retention failed: %v", err), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	default:
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+	}
+}
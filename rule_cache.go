@@ -0,0 +1,375 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"alertmanager/models"
+	"alertmanager/ruleengine"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// RULE_RELOAD_INTERVAL_SECONDS controls how often the rule snapshot is
+// refreshed from Mongo when change streams are not available.
+var ruleReloadInterval = envInt("RULE_RELOAD_INTERVAL_SECONDS", 60)
+
+// ruleCollections are watched for changes and loaded into the snapshot.
+var ruleCollections = []string{"alertrules", "tagrules", "notifyrules", "correlationrules", "holidaycalendars", lookupTableCollection, runbookCollection}
+
+type compiledAlertRule struct {
+	Rule  models.DbAlertRule
+	Group ruleengine.RulesGroup
+}
+
+type compiledTagRule struct {
+	Rule   models.DbTagRule
+	Group  ruleengine.RulesGroup
+	Regex  *regexp.Regexp       // compiled FieldExtraction, nil when not set
+	Lookup *compiledLookupTable // LookupTable, nil when not set
+}
+
+type compiledRunbook struct {
+	Runbook models.Runbook
+	Group   ruleengine.RulesGroup
+}
+
+type compiledNotifyRule struct {
+	Rule  models.DbNotifyRule
+	Group ruleengine.RulesGroup
+}
+
+// RuleSnapshot is an immutable, compiled copy of all rule collections. Alert
+// processing reads the current snapshot instead of querying Mongo per alert.
+type RuleSnapshot struct {
+	Version          int64
+	Hash             string
+	LoadedAt         time.Time
+	Reason           string
+	AlertRules       []compiledAlertRule
+	TagRules         []compiledTagRule
+	NotifyRules      []compiledNotifyRule
+	CorrelationRules []models.DbAlertGroup
+	HolidayCalendars []models.HolidayCalendar
+	LookupTables     []models.LookupTable
+	Runbooks         []compiledRunbook
+	// Errors lists rules that failed to compile and were left out.
+	Errors []string
+}
+
+// RuleVersion is the API view of the active snapshot.
+type RuleVersion struct {
+	Version          int64     `json:"version"`
+	Hash             string    `json:"hash"`
+	LoadedAt         time.Time `json:"loaded_at"`
+	Reason           string    `json:"reason"`
+	AlertRules       int       `json:"alert_rules"`
+	TagRules         int       `json:"tag_rules"`
+	NotifyRules      int       `json:"notify_rules"`
+	CorrelationRules int       `json:"correlation_rules"`
+	HolidayCalendars int       `json:"holiday_calendars"`
+	LookupTables     int       `json:"lookup_tables"`
+	Runbooks         int       `json:"runbooks"`
+	Errors           []string  `json:"errors"`
+}
+
+var ruleSnapshot atomic.Pointer[RuleSnapshot]
+var ruleReloadMutex sync.Mutex
+
+// emptyRules is used while no snapshot could be loaded yet.
+var emptyRules = &RuleSnapshot{}
+
+// initialLoadMutex guards the retries of a failed initial load.
+var initialLoadMutex sync.Mutex
+var lastInitialLoad time.Time
+
+// currentRules returns the active rule snapshot, loading it on first use.
+// If loading fails, alerts are processed without rules; the load is retried
+// at most once per RULE_RELOAD_INTERVAL_SECONDS so a degraded Mongo is not
+// hit with a full rule scan for every alert.
+func currentRules(mongoClient *mongo.Client) *RuleSnapshot {
+	if snapshot := ruleSnapshot.Load(); snapshot != nil {
+		return snapshot
+	}
+
+	// Alerts arriving while another one loads the rules do not wait for it.
+	if !initialLoadMutex.TryLock() {
+		return emptyRules
+	}
+	defer initialLoadMutex.Unlock()
+	if snapshot := ruleSnapshot.Load(); snapshot != nil {
+		return snapshot
+	}
+	if time.Since(lastInitialLoad) < time.Duration(ruleReloadInterval)*time.Second {
+		return emptyRules
+	}
+	lastInitialLoad = time.Now()
+
+	snapshot, err := ReloadRules(mongoClient, "initial load")
+	if err != nil {
+		fmt.Println("Error loading rules:", err)
+		return emptyRules
+	}
+	return snapshot
+}
+
+// ReloadRules loads and compiles every rule collection and swaps in the new
+// snapshot. On error the previous snapshot stays active. The version is only
+// bumped when the rule content actually changed.
+func ReloadRules(mongoClient *mongo.Client, reason string) (*RuleSnapshot, error) {
+	ruleReloadMutex.Lock()
+	defer ruleReloadMutex.Unlock()
+
+	snapshot, err := loadRuleSnapshot(context.TODO(), mongoClient)
+	if err != nil {
+		return nil, err
+	}
+	snapshot.Reason = reason
+
+	previous := ruleSnapshot.Load()
+	switch {
+	case previous == nil:
+		snapshot.Version = 1
+	case previous.Hash == snapshot.Hash:
+		snapshot.Version = previous.Version
+	default:
+		snapshot.Version = previous.Version + 1
+	}
+	ruleSnapshot.Store(snapshot)
+
+	calendars := make(map[string][]string, len(snapshot.HolidayCalendars))
+	for _, calendar := range snapshot.HolidayCalendars {
+		calendars[calendar.Name] = calendar.Dates
+	}
+	ruleengine.SetHolidayCalendars(calendars)
+
+	if previous == nil || previous.Version != snapshot.Version {
+		fmt.Printf("Loaded rules version %d (%s): %d alert, %d tag, %d notify, %d correlation rules, %d errors\n",
+			snapshot.Version, reason, len(snapshot.AlertRules), len(snapshot.TagRules), len(snapshot.NotifyRules), len(snapshot.CorrelationRules), len(snapshot.Errors))
+	}
+	return snapshot, nil
+}
+
+func loadRuleSnapshot(ctx context.Context, mongoClient *mongo.Client) (*RuleSnapshot, error) {
+	db := mongoClient.Database(mongodatabase)
+	snapshot := &RuleSnapshot{LoadedAt: time.Now()}
+
+	// Rules run in ascending Order; _id breaks ties so equal orders still
+	// run in a stable sequence (creation order).
+	byOrder := bson.D{{Key: "order", Value: 1}, {Key: "_id", Value: 1}}
+
+	var alertRules []models.DbAlertRule
+	if err := findAll(ctx, db.Collection("alertrules"), byOrder, &alertRules); err != nil {
+		return nil, err
+	}
+	var tagRules []models.DbTagRule
+	if err := findAll(ctx, db.Collection("tagrules"), byOrder, &tagRules); err != nil {
+		return nil, err
+	}
+	var notifyRules []models.DbNotifyRule
+	if err := findAll(ctx, db.Collection("notifyrules"), byOrder, &notifyRules); err != nil {
+		return nil, err
+	}
+	var runbooks []models.Runbook
+	if err := findAll(ctx, db.Collection(runbookCollection), byOrder, &runbooks); err != nil {
+		return nil, err
+	}
+	if err := findAll(ctx, db.Collection("correlationrules"), bson.D{{Key: "groupwindow", Value: 1}}, &snapshot.CorrelationRules); err != nil {
+		return nil, err
+	}
+	if err := findAll(ctx, db.Collection("holidaycalendars"), nil, &snapshot.HolidayCalendars); err != nil {
+		return nil, err
+	}
+	if err := findAll(ctx, db.Collection(lookupTableCollection), nil, &snapshot.LookupTables); err != nil {
+		return nil, err
+	}
+	lookups := make(map[string]*compiledLookupTable, len(snapshot.LookupTables))
+	for _, table := range snapshot.LookupTables {
+		lookups[table.Name] = compileLookupTable(table)
+	}
+
+	for _, rule := range alertRules {
+		group, err := ruleengine.ParseRuleObject(rule.RuleObject)
+		if err != nil {
+			snapshot.Errors = append(snapshot.Errors, fmt.Sprintf("alert rule %q: %v", rule.RuleName, err))
+			continue
+		}
+		snapshot.AlertRules = append(snapshot.AlertRules, compiledAlertRule{Rule: rule, Group: group})
+	}
+
+	for _, rule := range tagRules {
+		group, err := ruleengine.ParseRuleObject(rule.RuleObject)
+		if err != nil {
+			snapshot.Errors = append(snapshot.Errors, fmt.Sprintf("tag rule %q: %v", rule.RuleName, err))
+			continue
+		}
+		compiled := compiledTagRule{Rule: rule, Group: group}
+		if rule.FieldExtraction != "" {
+			compiled.Regex, err = regexp.Compile(rule.FieldExtraction)
+			if err != nil {
+				// Only this rule is skipped, the error shows in the rule version.
+				snapshot.Errors = append(snapshot.Errors, fmt.Sprintf("tag rule %q: invalid field extraction: %v", rule.RuleName, err))
+				continue
+			}
+		}
+		if rule.LookupTable != "" {
+			if compiled.Lookup = lookups[rule.LookupTable]; compiled.Lookup == nil {
+				snapshot.Errors = append(snapshot.Errors, fmt.Sprintf("tag rule %q: unknown lookup table %q", rule.RuleName, rule.LookupTable))
+				continue
+			}
+		}
+		snapshot.TagRules = append(snapshot.TagRules, compiled)
+	}
+
+	for _, rule := range notifyRules {
+		group, err := ruleengine.ParseRuleObject(rule.RuleObject)
+		if err != nil {
+			snapshot.Errors = append(snapshot.Errors, fmt.Sprintf("notify rule %q: %v", rule.RuleName, err))
+			continue
+		}
+		snapshot.NotifyRules = append(snapshot.NotifyRules, compiledNotifyRule{Rule: rule, Group: group})
+	}
+
+	for _, runbook := range runbooks {
+		group, err := ruleengine.ParseRuleObject(runbook.RuleObject)
+		if err != nil {
+			snapshot.Errors = append(snapshot.Errors, fmt.Sprintf("runbook %q: %v", runbook.Name, err))
+			continue
+		}
+		snapshot.Runbooks = append(snapshot.Runbooks, compiledRunbook{Runbook: runbook, Group: group})
+	}
+
+	hashInput, err := json.Marshal([]interface{}{alertRules, tagRules, notifyRules, snapshot.CorrelationRules, snapshot.HolidayCalendars, snapshot.LookupTables, runbooks})
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(hashInput)
+	snapshot.Hash = hex.EncodeToString(sum[:8])
+	return snapshot, nil
+}
+
+// findAll reads a whole collection, optionally sorted, into results.
+func findAll(ctx context.Context, collection *mongo.Collection, sort bson.D, results interface{}) error {
+	findOptions := options.Find()
+	if sort != nil {
+		findOptions.SetSort(sort)
+	}
+	cursor, err := collection.Find(ctx, bson.D{}, findOptions)
+	if err != nil {
+		return fmt.Errorf("loading %s: %v", collection.Name(), err)
+	}
+	defer cursor.Close(ctx)
+	if err := cursor.All(ctx, results); err != nil {
+		return fmt.Errorf("decoding %s: %v", collection.Name(), err)
+	}
+	return nil
+}
+
+// StartRuleReloader keeps the rule snapshot fresh. Changes are picked up
+// immediately through a Mongo change stream where the deployment supports it
+// (replica sets), with a periodic reload as a fallback in every case.
+func StartRuleReloader(mongoClient *mongo.Client) {
+	interval := time.Duration(ruleReloadInterval) * time.Second
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if _, err := ReloadRules(mongoClient, "timer"); err != nil {
+				fmt.Println("Error reloading rules:", err)
+			}
+		}
+	}()
+
+	go watchRuleChanges(mongoClient, interval)
+}
+
+func watchRuleChanges(mongoClient *mongo.Client, retry time.Duration) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"ns.coll": bson.M{"$in": ruleCollections}}}},
+	}
+	for {
+		stream, err := mongoClient.Database(mongodatabase).Watch(context.Background(), pipeline)
+		if err != nil {
+			fmt.Println("Rule change stream unavailable, using periodic reload only:", err)
+			return
+		}
+		fmt.Println("\x1b[32mWatching rule collections for changes\x1b[0m")
+
+		for stream.Next(context.Background()) {
+			var event struct {
+				OperationType string `bson:"operationType"`
+				Ns            struct {
+					Coll string `bson:"coll"`
+				} `bson:"ns"`
+			}
+			stream.Decode(&event)
+			reason := fmt.Sprintf("%s on %s", event.OperationType, event.Ns.Coll)
+			if _, err := ReloadRules(mongoClient, reason); err != nil {
+				fmt.Println("Error reloading rules:", err)
+			}
+		}
+		if err := stream.Err(); err != nil {
+			fmt.Println("Rule change stream error, reconnecting:", err)
+		}
+		stream.Close(context.Background())
+		time.Sleep(retry)
+	}
+}
+
+func ruleVersion(snapshot *RuleSnapshot) RuleVersion {
+	errors := snapshot.Errors
+	if errors == nil {
+		errors = []string{}
+	}
+	return RuleVersion{
+		Version:          snapshot.Version,
+		Hash:             snapshot.Hash,
+		LoadedAt:         snapshot.LoadedAt,
+		Reason:           snapshot.Reason,
+		AlertRules:       len(snapshot.AlertRules),
+		TagRules:         len(snapshot.TagRules),
+		NotifyRules:      len(snapshot.NotifyRules),
+		CorrelationRules: len(snapshot.CorrelationRules),
+		HolidayCalendars: len(snapshot.HolidayCalendars),
+		LookupTables:     len(snapshot.LookupTables),
+		Runbooks:         len(snapshot.Runbooks),
+		Errors:           errors,
+	}
+}
+
+// RuleReloadHandler reports the active rule version (GET) or forces a
+// reload from Mongo (POST).
+func RuleReloadHandler(w http.ResponseWriter, r *http.Request, mongoClient *mongo.Client) {
+	var snapshot *RuleSnapshot
+	switch r.Method {
+	case http.MethodGet:
+		snapshot = currentRules(mongoClient)
+	case http.MethodPost:
+		var err error
+		snapshot, err = ReloadRules(mongoClient, "api")
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error reloading rules: %v", err), http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ruleVersion(snapshot))
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"alertmanager/models"
+	"alertmanager/ruleengine"
+
+	"github.com/mitchellh/mapstructure"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// RuleErrorStat counts the evaluation errors of one stored rule.
+type RuleErrorStat struct {
+	Kind      string    `json:"kind"`
+	RuleName  string    `json:"rule_name"`
+	Errors    int64     `json:"errors"`
+	LastError string    `json:"last_error"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+var ruleErrorStatsMutex sync.Mutex
+var ruleErrorStats = make(map[string]*RuleErrorStat)
+
+// evaluateRule evaluates a parsed RuleObject against an alert map. Rules that
+// cannot be evaluated (type mismatches, bad values) count as not matched and
+// are logged and counted against the rule instead of failing the request.
+func evaluateRule(kind string, ruleId primitive.ObjectID, ruleName string, alertMap map[string]interface{}, rulesGroup ruleengine.RulesGroup) bool {
+	start := time.Now()
+	res, err := ruleengine.EvaluateRulesGroup(alertMap, rulesGroup)
+	recordRuleStats(kind, ruleId, ruleName, res, time.Since(start))
+	if err != nil {
+		log.Printf("Warning: %s rule %q evaluation errors: %v\n", kind, ruleName, err)
+		recordRuleError(kind, ruleName, err)
+	}
+	return res
+}
+
+// alertToMap converts an alert to the map rules are evaluated against.
+// mapstructure turns the embedded time of CustomTime fields into an empty
+// map, so those fields are replaced by their time.Time values.
+func alertToMap(alert *models.DbAlert) (map[string]interface{}, error) {
+	var alertMap map[string]interface{}
+	if err := mapstructure.Decode(alert, &alertMap); err != nil {
+		return nil, err
+	}
+	alertMap["AlertFirstTime"] = alert.AlertFirstTime.Time
+	alertMap["AlertLastTime"] = alert.AlertLastTime.Time
+	alertMap["AlertClearTime"] = alert.AlertClearTime.Time
+	return alertMap, nil
+}
+
+func recordRuleError(kind string, ruleName string, err error) {
+	ruleErrorStatsMutex.Lock()
+	defer ruleErrorStatsMutex.Unlock()
+
+	key := kind + "/" + ruleName
+	stat, ok := ruleErrorStats[key]
+	if !ok {
+		stat = &RuleErrorStat{Kind: kind, RuleName: ruleName}
+		ruleErrorStats[key] = stat
+	}
+	stat.Errors++
+	stat.LastError = err.Error()
+	stat.LastSeen = time.Now()
+}
+
+// RuleEngineMetricsHandler reports the rule engine counters and the rules
+// that failed to evaluate.
+func RuleEngineMetricsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ruleErrorStatsMutex.Lock()
+	errorStats := make([]RuleErrorStat, 0, len(ruleErrorStats))
+	for _, stat := range ruleErrorStats {
+		errorStats = append(errorStats, *stat)
+	}
+	ruleErrorStatsMutex.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"engine":      ruleengine.GetMetrics(),
+		"rule_errors": errorStats,
+	})
+}
@@ -0,0 +1,439 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+
+	"alertmanager/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const ruleRevisionCollection = "rulerevisions"
+
+var (
+	errRuleNotFound = errors.New("rule not found")
+	errRuleConflict = errors.New("rule was changed concurrently")
+)
+
+// RuleDiff is one field that differs between two revisions of a rule.
+type RuleDiff struct {
+	Field string      `json:"field"`
+	From  interface{} `json:"from"`
+	To    interface{} `json:"to"`
+}
+
+type RuleDiffResponse struct {
+	RuleKind string     `json:"rulekind"`
+	RuleID   string     `json:"ruleid"`
+	From     int        `json:"from"`
+	To       int        `json:"to"`
+	Changes  []RuleDiff `json:"changes"`
+}
+
+// EnsureRuleRevisionIndexes makes (kind, rule, revision) unique, so two
+// writers can never record the same revision of a rule.
+func EnsureRuleRevisionIndexes(mongoClient *mongo.Client) error {
+	index := mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "rulekind", Value: 1},
+			{Key: "ruleid", Value: 1},
+			{Key: "revision", Value: 1},
+		},
+		Options: options.Index().SetUnique(true),
+	}
+	_, err := mongoClient.Database(mongodatabase).Collection(ruleRevisionCollection).Indexes().CreateOne(context.TODO(), index)
+	return err
+}
+
+// ruleAuthor identifies who made a rule change, taken from the X-User
+// header set by the UI or API gateway.
+func ruleAuthor(r *http.Request) string {
+	if author := r.Header.Get("X-User"); author != "" {
+		return author
+	}
+	return "unknown"
+}
+
+// ruleWriteStatus maps the errors of rule writes to HTTP status codes.
+func ruleWriteStatus(err error) int {
+	switch {
+	case errors.Is(err, errRuleNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, errRuleConflict):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+// revisionFilter matches the rule only while it is still at the given
+// revision. Rules created before versioning have no revision field.
+func revisionFilter(id primitive.ObjectID, revision int) bson.M {
+	if revision == 0 {
+		return bson.M{"_id": id, "revision": bson.M{"$in": bson.A{0, nil}}}
+	}
+	return bson.M{"_id": id, "revision": revision}
+}
+
+// recordRuleRevision stores a copy of the rule as its current revision. Rule
+// writes are guarded by revisionFilter, so only the writer that moved the rule
+// to this revision records it; an existing document for the same revision can
+// only be left over from a write that never happened and is overwritten.
+func recordRuleRevision(ctx context.Context, mongoClient *mongo.Client, kind string, rule validatedRule, action string, author string) error {
+	raw, err := bson.Marshal(rule)
+	if err != nil {
+		return err
+	}
+	var document bson.M
+	if err := bson.Unmarshal(raw, &document); err != nil {
+		return err
+	}
+
+	revision := models.RuleRevision{
+		RuleKind:  kind,
+		RuleID:    ruleField(rule, "ID").(primitive.ObjectID),
+		Revision:  ruleField(rule, "Revision").(int),
+		Action:    action,
+		Author:    author,
+		CreatedAt: time.Now(),
+		Rule:      document,
+	}
+	filter := bson.M{"rulekind": revision.RuleKind, "ruleid": revision.RuleID, "revision": revision.Revision}
+	_, err = mongoClient.Database(mongodatabase).Collection(ruleRevisionCollection).ReplaceOne(ctx, filter, revision, options.Replace().SetUpsert(true))
+	return err
+}
+
+// recordWrittenRevision records the revision after the rule write succeeded.
+// The rule is already changed at this point, so a failure only leaves a gap in
+// the history and is logged rather than reported as a failed write.
+func recordWrittenRevision(ctx context.Context, mongoClient *mongo.Client, kind string, rule validatedRule, action string, author string) {
+	if err := recordRuleRevision(ctx, mongoClient, kind, rule, action, author); err != nil {
+		fmt.Println("Error recording rule revision:", err)
+	}
+}
+
+// replaceRule saves rule as the next revision of the stored rule. The replace
+// only succeeds if nobody else changed the rule in between; a non-zero
+// Revision in rule must name the revision the caller edited.
+func replaceRule(ctx context.Context, mongoClient *mongo.Client, kind string, id primitive.ObjectID, rule validatedRule, action string, author string) error {
+	collection := mongoClient.Database(mongodatabase).Collection(kind)
+
+	current := reflect.New(reflect.TypeOf(rule).Elem()).Interface().(validatedRule)
+	err := collection.FindOne(ctx, bson.M{"_id": id}).Decode(current)
+	if err == mongo.ErrNoDocuments {
+		return errRuleNotFound
+	} else if err != nil {
+		return err
+	}
+
+	currentRevision := ruleField(current, "Revision").(int)
+	if edited := ruleField(rule, "Revision").(int); action == models.RevisionActionUpdate && edited != 0 && edited != currentRevision {
+		return fmt.Errorf("%w: edited revision %d, current revision is %d", errRuleConflict, edited, currentRevision)
+	}
+
+	// Keep the state from before versioning so the first change can be
+	// diffed and rolled back.
+	if currentRevision == 0 {
+		if err := recordRuleRevision(ctx, mongoClient, kind, current, models.RevisionActionBaseline, ""); err != nil && !mongo.IsDuplicateKeyError(err) {
+			return err
+		}
+	}
+
+	setRuleField(rule, "ID", id)
+	setRuleField(rule, "Revision", currentRevision+1)
+	result, err := collection.ReplaceOne(ctx, revisionFilter(id, currentRevision), rule)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("%w: revision %d was replaced", errRuleConflict, currentRevision)
+	}
+	recordWrittenRevision(ctx, mongoClient, kind, rule, action, author)
+	return nil
+}
+
+// deleteRule removes the rule and records the deleted state as a revision, so
+// it can be restored by a rollback.
+func deleteRule(ctx context.Context, mongoClient *mongo.Client, kind string, id primitive.ObjectID, current validatedRule, author string) error {
+	collection := mongoClient.Database(mongodatabase).Collection(kind)
+
+	err := collection.FindOne(ctx, bson.M{"_id": id}).Decode(current)
+	if err == mongo.ErrNoDocuments {
+		return errRuleNotFound
+	} else if err != nil {
+		return err
+	}
+	currentRevision := ruleField(current, "Revision").(int)
+
+	result, err := collection.DeleteOne(ctx, revisionFilter(id, currentRevision))
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return fmt.Errorf("%w: revision %d was replaced", errRuleConflict, currentRevision)
+	}
+	setRuleField(current, "Revision", currentRevision+1)
+	recordWrittenRevision(ctx, mongoClient, kind, current, models.RevisionActionDelete, author)
+	return nil
+}
+
+// findRuleRevision loads one revision of a rule, or the latest one when
+// revision is negative.
+func findRuleRevision(ctx context.Context, mongoClient *mongo.Client, kind string, id primitive.ObjectID, revision int) (models.RuleRevision, error) {
+	filter := bson.M{"rulekind": kind, "ruleid": id}
+	if revision >= 0 {
+		filter["revision"] = revision
+	}
+	findOptions := options.FindOne().SetSort(bson.D{{Key: "revision", Value: -1}})
+
+	var result models.RuleRevision
+	err := mongoClient.Database(mongodatabase).Collection(ruleRevisionCollection).FindOne(ctx, filter, findOptions).Decode(&result)
+	if err == mongo.ErrNoDocuments {
+		if revision >= 0 {
+			return result, fmt.Errorf("%w: revision %d not found", errRuleNotFound, revision)
+		}
+		return result, fmt.Errorf("%w: no revisions recorded", errRuleNotFound)
+	}
+	return result, err
+}
+
+// ruleRequestTarget validates the {kind} and {id} path values shared by the
+// revision endpoints.
+func ruleRequestTarget(w http.ResponseWriter, r *http.Request) (string, primitive.ObjectID, bool) {
+	kindName := r.PathValue("kind")
+	if _, ok := ruleKinds[kindName]; !ok {
+		http.Error(w, fmt.Sprintf("Unknown rule collection %q", kindName), http.StatusNotFound)
+		return "", primitive.NilObjectID, false
+	}
+	id, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid rule id", http.StatusBadRequest)
+		return "", primitive.NilObjectID, false
+	}
+	return kindName, id, true
+}
+
+// RuleRevisionsHandler lists the revisions of a rule, newest first, or
+// returns a single revision when the path names one.
+func RuleRevisionsHandler(w http.ResponseWriter, r *http.Request, mongoClient *mongo.Client) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	kindName, id, ok := ruleRequestTarget(w, r)
+	if !ok {
+		return
+	}
+
+	if value := r.PathValue("revision"); value != "" {
+		revision, err := strconv.Atoi(value)
+		if err != nil || revision < 0 {
+			http.Error(w, "Invalid revision", http.StatusBadRequest)
+			return
+		}
+		result, err := findRuleRevision(context.TODO(), mongoClient, kindName, id, revision)
+		if err != nil {
+			http.Error(w, err.Error(), ruleWriteStatus(err))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+		return
+	}
+
+	revisions := []models.RuleRevision{}
+	collection := mongoClient.Database(mongodatabase).Collection(ruleRevisionCollection)
+	cursor, err := collection.Find(context.TODO(), bson.M{"rulekind": kindName, "ruleid": id},
+		options.Find().SetSort(bson.D{{Key: "revision", Value: -1}}))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(context.TODO())
+	if err := cursor.All(context.TODO(), &revisions); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(revisions)
+}
+
+// RuleDiffHandler compares two revisions of a rule field by field. "to"
+// defaults to the latest revision and "from" to the one before it.
+func RuleDiffHandler(w http.ResponseWriter, r *http.Request, mongoClient *mongo.Client) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	kindName, id, ok := ruleRequestTarget(w, r)
+	if !ok {
+		return
+	}
+
+	to := -1
+	if value := r.URL.Query().Get("to"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			http.Error(w, "Invalid 'to' revision", http.StatusBadRequest)
+			return
+		}
+		to = parsed
+	}
+	toRevision, err := findRuleRevision(context.TODO(), mongoClient, kindName, id, to)
+	if err != nil {
+		http.Error(w, err.Error(), ruleWriteStatus(err))
+		return
+	}
+
+	from := toRevision.Revision - 1
+	if value := r.URL.Query().Get("from"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			http.Error(w, "Invalid 'from' revision", http.StatusBadRequest)
+			return
+		}
+		from = parsed
+	}
+	fromRevision, err := findRuleRevision(context.TODO(), mongoClient, kindName, id, from)
+	if err != nil {
+		http.Error(w, err.Error(), ruleWriteStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(RuleDiffResponse{
+		RuleKind: kindName,
+		RuleID:   id.Hex(),
+		From:     fromRevision.Revision,
+		To:       toRevision.Revision,
+		Changes:  diffRuleDocuments(fromRevision.Rule, toRevision.Rule),
+	})
+}
+
+// diffRuleDocuments lists the top level fields that differ between two rule
+// documents, ignoring the bookkeeping fields.
+func diffRuleDocuments(from, to bson.M) []RuleDiff {
+	fields := map[string]bool{}
+	for field := range from {
+		fields[field] = true
+	}
+	for field := range to {
+		fields[field] = true
+	}
+	delete(fields, "_id")
+	delete(fields, "revision")
+
+	changes := []RuleDiff{}
+	for field := range fields {
+		fromJson, _ := json.Marshal(from[field])
+		toJson, _ := json.Marshal(to[field])
+		if string(fromJson) != string(toJson) {
+			changes = append(changes, RuleDiff{Field: field, From: from[field], To: to[field]})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+	return changes
+}
+
+// RuleRollbackHandler restores a rule to the content of an earlier revision.
+// The restored content is saved as a new revision, so the rollback itself
+// shows up in the history and can be undone. Deleted rules are recreated.
+func RuleRollbackHandler(w http.ResponseWriter, r *http.Request, mongoClient *mongo.Client) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	kindName, id, ok := ruleRequestTarget(w, r)
+	if !ok {
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Error reading request body", http.StatusInternalServerError)
+		return
+	}
+	var request struct {
+		Revision *int `json:"revision"`
+	}
+	if err := json.Unmarshal(body, &request); err != nil || request.Revision == nil || *request.Revision < 0 {
+		http.Error(w, "Body must contain the revision to roll back to", http.StatusBadRequest)
+		return
+	}
+
+	ctx := context.TODO()
+	target, err := findRuleRevision(ctx, mongoClient, kindName, id, *request.Revision)
+	if err != nil {
+		http.Error(w, err.Error(), ruleWriteStatus(err))
+		return
+	}
+
+	rule := ruleKinds[kindName].newRule()
+	raw, err := bson.Marshal(target.Rule)
+	if err == nil {
+		err = bson.Unmarshal(raw, rule)
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error decoding revision: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if err := rule.Validate(); err != nil {
+		http.Error(w, fmt.Sprintf("Revision %d is no longer valid: %v", target.Revision, err), http.StatusUnprocessableEntity)
+		return
+	}
+
+	err = replaceRule(ctx, mongoClient, kindName, id, rule, models.RevisionActionRollback, ruleAuthor(r))
+	if errors.Is(err, errRuleNotFound) {
+		err = restoreDeletedRule(ctx, mongoClient, kindName, id, rule, ruleAuthor(r))
+	}
+	if err != nil {
+		http.Error(w, err.Error(), ruleWriteStatus(err))
+		return
+	}
+	reloadAfterRuleChange(mongoClient, "rollback on "+kindName)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rule)
+}
+
+// restoreDeletedRule re-inserts a deleted rule as the revision after its
+// latest recorded one.
+func restoreDeletedRule(ctx context.Context, mongoClient *mongo.Client, kind string, id primitive.ObjectID, rule validatedRule, author string) error {
+	latest, err := findRuleRevision(ctx, mongoClient, kind, id, -1)
+	if err != nil {
+		return err
+	}
+	setRuleField(rule, "ID", id)
+	setRuleField(rule, "Revision", latest.Revision+1)
+	if _, err := mongoClient.Database(mongodatabase).Collection(kind).InsertOne(ctx, rule); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return fmt.Errorf("%w: rule was recreated", errRuleConflict)
+		}
+		return err
+	}
+	recordWrittenRevision(ctx, mongoClient, kind, rule, models.RevisionActionRollback, author)
+	return nil
+}
+
+// ruleHit records which revision of a rule matched an alert.
+func ruleHit(kind string, id primitive.ObjectID, name string, revision int) models.RuleHit {
+	return models.RuleHit{
+		RuleKind:  kind,
+		RuleID:    id,
+		RuleName:  name,
+		Revision:  revision,
+		MatchedAt: time.Now(),
+	}
+}
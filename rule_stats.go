@@ -0,0 +1,326 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"alertmanager/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// RULE_STATS_FLUSH_SECONDS controls how often the in-memory rule counters
+// are added to the rulestats collection.
+var ruleStatsFlushInterval = envInt("RULE_STATS_FLUSH_SECONDS", 30)
+
+// defaultUnusedDays is the number of days without a match after which a rule
+// is reported as a cleanup candidate.
+const defaultUnusedDays = 30
+
+// ruleStatsDelta accumulates the counters of one rule between flushes.
+type ruleStatsDelta struct {
+	kind          string
+	name          string
+	evaluations   int64
+	matches       int64
+	duration      time.Duration
+	lastEvaluated time.Time
+	lastMatched   time.Time
+}
+
+var ruleStatsMutex sync.Mutex
+var pendingRuleStats = make(map[primitive.ObjectID]*ruleStatsDelta)
+
+// RuleStatsEntry is the API view of the counters of one active rule.
+type RuleStatsEntry struct {
+	RuleKind         string     `json:"rulekind"`
+	RuleID           string     `json:"ruleid"`
+	RuleName         string     `json:"rulename"`
+	Evaluations      int64      `json:"evaluations"`
+	Matches          int64      `json:"matches"`
+	MatchRate        float64    `json:"match_rate"`
+	TotalDurationMs  float64    `json:"total_duration_ms"`
+	AvgDurationMs    float64    `json:"avg_duration_ms"`
+	LastMatchedAt    *time.Time `json:"last_matched_at"`
+	Dropped          int64      `json:"dropped"`
+	Discarded        int64      `json:"discarded"`
+	CleanupCandidate bool       `json:"cleanup_candidate"`
+}
+
+type RuleKindSummary struct {
+	Rules       int   `json:"rules"`
+	Evaluations int64 `json:"evaluations"`
+	Matches     int64 `json:"matches"`
+}
+
+type RuleDashboard struct {
+	TotalRules        int                        `json:"total_rules"`
+	CleanupCandidates int                        `json:"cleanup_candidates"`
+	UnusedDays        int                        `json:"unused_days"`
+	ByKind            map[string]RuleKindSummary `json:"by_kind"`
+	TopMatched        []RuleStatsEntry           `json:"top_matched"`
+	Slowest           []RuleStatsEntry           `json:"slowest"`
+	Unused            []RuleStatsEntry           `json:"unused"`
+}
+
+// recordRuleStats counts one evaluation of a rule.
+func recordRuleStats(kind string, ruleId primitive.ObjectID, ruleName string, matched bool, duration time.Duration) {
+	if ruleId.IsZero() {
+		return
+	}
+	ruleStatsMutex.Lock()
+	defer ruleStatsMutex.Unlock()
+
+	delta, ok := pendingRuleStats[ruleId]
+	if !ok {
+		delta = &ruleStatsDelta{kind: kind}
+		pendingRuleStats[ruleId] = delta
+	}
+	now := time.Now()
+	delta.name = ruleName
+	delta.evaluations++
+	delta.duration += duration
+	delta.lastEvaluated = now
+	if matched {
+		delta.matches++
+		delta.lastMatched = now
+	}
+}
+
+// flushRuleStats adds the pending counters to the rulestats collection.
+// Counters whose update failed are kept for the next flush.
+func flushRuleStats(mongoClient *mongo.Client) error {
+	ruleStatsMutex.Lock()
+	pending := pendingRuleStats
+	pendingRuleStats = make(map[primitive.ObjectID]*ruleStatsDelta)
+	ruleStatsMutex.Unlock()
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	writes := make([]mongo.WriteModel, 0, len(pending))
+	ids := make([]primitive.ObjectID, 0, len(pending))
+	for id, delta := range pending {
+		ids = append(ids, id)
+		max := bson.M{"lastEvaluatedAt": delta.lastEvaluated}
+		if !delta.lastMatched.IsZero() {
+			max["lastMatchedAt"] = delta.lastMatched
+		}
+		update := bson.M{
+			"$inc": bson.M{
+				"evaluations": delta.evaluations,
+				"matches":     delta.matches,
+				"durationNs":  int64(delta.duration),
+			},
+			"$set": bson.M{"rulekind": delta.kind, "rulename": delta.name},
+			"$max": max,
+		}
+		writes = append(writes, mongo.NewUpdateOneModel().SetFilter(bson.M{"_id": id}).SetUpdate(update).SetUpsert(true))
+	}
+
+	collection := mongoClient.Database(mongodatabase).Collection(ruleStatsCollection)
+	if _, err := collection.BulkWrite(context.TODO(), writes, options.BulkWrite().SetOrdered(false)); err != nil {
+		// The write is unordered, so when individual updates fail the others
+		// are applied and only the failed ones are kept.
+		failed := pending
+		var bulkErr mongo.BulkWriteException
+		if errors.As(err, &bulkErr) {
+			failed = make(map[primitive.ObjectID]*ruleStatsDelta, len(bulkErr.WriteErrors))
+			for _, writeErr := range bulkErr.WriteErrors {
+				id := ids[writeErr.Index]
+				failed[id] = pending[id]
+			}
+		}
+
+		ruleStatsMutex.Lock()
+		for id, delta := range failed {
+			if current, ok := pendingRuleStats[id]; ok {
+				current.evaluations += delta.evaluations
+				current.matches += delta.matches
+				current.duration += delta.duration
+				if current.lastMatched.IsZero() {
+					current.lastMatched = delta.lastMatched
+				}
+			} else {
+				pendingRuleStats[id] = delta
+			}
+		}
+		ruleStatsMutex.Unlock()
+		return err
+	}
+	return nil
+}
+
+// StartRuleStatsFlusher periodically persists the rule counters.
+func StartRuleStatsFlusher(mongoClient *mongo.Client) {
+	interval := time.Duration(ruleStatsFlushInterval) * time.Second
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := flushRuleStats(mongoClient); err != nil {
+				fmt.Println("Error flushing rule stats:", err)
+			}
+		}
+	}()
+}
+
+// activeRuleStats returns the counters of every rule in the active snapshot,
+// including rules that were never evaluated. Rules created more than
+// unusedDays ago without a match since then are cleanup candidates.
+func activeRuleStats(mongoClient *mongo.Client, unusedDays int) ([]RuleStatsEntry, error) {
+	if err := flushRuleStats(mongoClient); err != nil {
+		fmt.Println("Error flushing rule stats:", err)
+	}
+
+	var stored []models.RuleStats
+	if err := findAll(context.TODO(), mongoClient.Database(mongodatabase).Collection(ruleStatsCollection), nil, &stored); err != nil {
+		return nil, err
+	}
+	byId := make(map[primitive.ObjectID]models.RuleStats, len(stored))
+	for _, stats := range stored {
+		byId[stats.ID] = stats
+	}
+
+	cutoff := time.Now().AddDate(0, 0, -unusedDays)
+	entries := []RuleStatsEntry{}
+	add := func(kind string, id primitive.ObjectID, name string) {
+		stats := byId[id]
+		entry := RuleStatsEntry{
+			RuleKind:        kind,
+			RuleID:          id.Hex(),
+			RuleName:        name,
+			Evaluations:     stats.Evaluations,
+			Matches:         stats.Matches,
+			TotalDurationMs: float64(stats.DurationNs) / 1e6,
+			Dropped:         stats.Dropped,
+			Discarded:       stats.Discarded,
+		}
+		if stats.Evaluations > 0 {
+			entry.MatchRate = float64(stats.Matches) / float64(stats.Evaluations)
+			entry.AvgDurationMs = entry.TotalDurationMs / float64(stats.Evaluations)
+		}
+		if !stats.LastMatchedAt.IsZero() {
+			lastMatched := stats.LastMatchedAt
+			entry.LastMatchedAt = &lastMatched
+		}
+		entry.CleanupCandidate = id.Timestamp().Before(cutoff) && stats.LastMatchedAt.Before(cutoff)
+		entries = append(entries, entry)
+	}
+
+	snapshot := currentRules(mongoClient)
+	for _, compiled := range snapshot.AlertRules {
+		add("alert", compiled.Rule.ID, compiled.Rule.RuleName)
+	}
+	for _, compiled := range snapshot.TagRules {
+		add("tag", compiled.Rule.ID, compiled.Rule.RuleName)
+	}
+	for _, compiled := range snapshot.NotifyRules {
+		add("notify", compiled.Rule.ID, compiled.Rule.RuleName)
+	}
+	for _, rule := range snapshot.CorrelationRules {
+		add("correlation", rule.ID, rule.GroupName)
+	}
+	for _, compiled := range snapshot.Runbooks {
+		add("runbook", compiled.Runbook.ID, compiled.Runbook.Name)
+	}
+	return entries, nil
+}
+
+func unusedDaysParam(r *http.Request) int {
+	if days, err := strconv.Atoi(r.URL.Query().Get("unused_days")); err == nil && days > 0 {
+		return days
+	}
+	return defaultUnusedDays
+}
+
+// RuleStatsHandler lists per-rule evaluation counters. Optional parameters:
+// kind (alert, tag, notify, correlation, runbook), unused_days (default 30) and
+// unused=true to list only cleanup candidates.
+func RuleStatsHandler(w http.ResponseWriter, r *http.Request, mongoClient *mongo.Client) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	entries, err := activeRuleStats(mongoClient, unusedDaysParam(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	kind := r.URL.Query().Get("kind")
+	onlyUnused := r.URL.Query().Get("unused") == "true"
+	filtered := []RuleStatsEntry{}
+	for _, entry := range entries {
+		if (kind == "" || entry.RuleKind == kind) && (!onlyUnused || entry.CleanupCandidate) {
+			filtered = append(filtered, entry)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(filtered)
+}
+
+// RuleDashboardHandler summarises rule usage for the dashboard.
+func RuleDashboardHandler(w http.ResponseWriter, r *http.Request, mongoClient *mongo.Client) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	unusedDays := unusedDaysParam(r)
+	entries, err := activeRuleStats(mongoClient, unusedDays)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	dashboard := RuleDashboard{
+		TotalRules: len(entries),
+		UnusedDays: unusedDays,
+		ByKind:     make(map[string]RuleKindSummary),
+		Unused:     []RuleStatsEntry{},
+	}
+	for _, entry := range entries {
+		summary := dashboard.ByKind[entry.RuleKind]
+		summary.Rules++
+		summary.Evaluations += entry.Evaluations
+		summary.Matches += entry.Matches
+		dashboard.ByKind[entry.RuleKind] = summary
+		if entry.CleanupCandidate {
+			dashboard.CleanupCandidates++
+			dashboard.Unused = append(dashboard.Unused, entry)
+		}
+	}
+
+	dashboard.TopMatched = topRuleStats(entries, func(a, b RuleStatsEntry) bool { return a.Matches > b.Matches })
+	dashboard.Slowest = topRuleStats(entries, func(a, b RuleStatsEntry) bool { return a.AvgDurationMs > b.AvgDurationMs })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(dashboard)
+}
+
+// topRuleStats returns the first five entries in the given order.
+func topRuleStats(entries []RuleStatsEntry, less func(a, b RuleStatsEntry) bool) []RuleStatsEntry {
+	sorted := append([]RuleStatsEntry{}, entries...)
+	sort.SliceStable(sorted, func(i, j int) bool { return less(sorted[i], sorted[j]) })
+	if len(sorted) > 5 {
+		sorted = sorted[:5]
+	}
+	return sorted
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"time"
+
+	"alertmanager/models"
+	"alertmanager/ruleengine"
+	"alertmanager/utilities"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// RuleTestRequest is the body of a rule test. Either RuleId refers to a
+// stored rule, or Rule holds a rule document of the given type.
+type RuleTestRequest struct {
+	RuleType string                 `json:"ruleType"` // alert, tag or notify
+	RuleId   string                 `json:"ruleId"`
+	Rule     json.RawMessage        `json:"rule"`
+	Alert    utilities.ApiAlertData `json:"alert"`
+}
+
+type RuleTestResponse struct {
+	RuleType string            `json:"ruleType"`
+	RuleName string            `json:"ruleName"`
+	Matched  bool              `json:"matched"`
+	Trace    *ruleengine.Trace `json:"trace"`
+	Errors   []string          `json:"errors"`
+	Actions  []string          `json:"actions"`
+	Alert    models.DbAlert    `json:"alert"`
+}
+
+// ruleTypeCollections maps the rule types accepted by the rule APIs to their
+// collections.
+var ruleTypeCollections = map[string]string{
+	"alert":  "alertrules",
+	"tag":    "tagrules",
+	"notify": "notifyrules",
+}
+
+// RuleTestHandler runs a single rule against a sample alert payload without
+// touching any stored data, and explains why it did or did not match.
+func RuleTestHandler(w http.ResponseWriter, r *http.Request, mongoClient *mongo.Client) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Error reading request body", http.StatusInternalServerError)
+		return
+	}
+
+	var request RuleTestRequest
+	if err := json.Unmarshal(body, &request); err != nil {
+		http.Error(w, "Error parsing JSON", http.StatusBadRequest)
+		return
+	}
+	if _, ok := ruleTypeCollections[request.RuleType]; !ok {
+		http.Error(w, "ruleType must be one of alert, tag or notify", http.StatusBadRequest)
+		return
+	}
+	if request.Alert == nil {
+		http.Error(w, "alert is required", http.StatusBadRequest)
+		return
+	}
+
+	// The sample alert goes through the same construction as a real one.
+	if getStringOrEmpty(request.Alert, "alertTime") == "" {
+		request.Alert["alertTime"] = time.Now().Format("2006-01-02 15:04:05")
+	}
+	alert, err := newAlertFromApiData(request.Alert)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid alertTime: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	response, err := testRule(mongoClient, request, &alert)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// preparedRule is a rule decoded for testing, with its actions ready to be
+// applied to any in-memory alert. Applying is a dry run: errors are not
+// counted in the rule error stats.
+type preparedRule struct {
+	name           string
+	group          ruleengine.RulesGroup
+	stopProcessing bool
+	apply          func(alert *models.DbAlert) []string
+}
+
+// prepareTestRule loads or decodes the rule of a test or backtest request.
+func prepareTestRule(mongoClient *mongo.Client, request RuleTestRequest) (*preparedRule, error) {
+	var prepared preparedRule
+	var ruleObject string
+
+	switch request.RuleType {
+	case "alert":
+		var rule models.DbAlertRule
+		if err := loadTestRule(mongoClient, request, &rule); err != nil {
+			return nil, err
+		}
+		prepared.name, ruleObject, prepared.stopProcessing = rule.RuleName, rule.RuleObject, rule.StopProcessing
+		prepared.apply = func(alert *models.DbAlert) []string { return applyAlertRule(alert, rule) }
+	case "tag":
+		var rule models.DbTagRule
+		if err := loadTestRule(mongoClient, request, &rule); err != nil {
+			return nil, err
+		}
+		compiled := compiledTagRule{Rule: rule}
+		if rule.FieldExtraction != "" {
+			re, err := regexp.Compile(rule.FieldExtraction)
+			if err != nil {
+				return nil, fmt.Errorf("invalid fieldextraction: %v", err)
+			}
+			compiled.Regex = re
+		}
+		if rule.LookupTable != "" {
+			for _, table := range currentRules(mongoClient).LookupTables {
+				if table.Name == rule.LookupTable {
+					compiled.Lookup = compileLookupTable(table)
+				}
+			}
+			if compiled.Lookup == nil {
+				return nil, fmt.Errorf("unknown lookup table %q", rule.LookupTable)
+			}
+		}
+		prepared.name, ruleObject, prepared.stopProcessing = rule.RuleName, rule.RuleObject, rule.StopProcessing
+		prepared.apply = func(alert *models.DbAlert) []string { return applyTagRule(alert, compiled, true) }
+	case "notify":
+		var rule models.DbNotifyRule
+		if err := loadTestRule(mongoClient, request, &rule); err != nil {
+			return nil, err
+		}
+		prepared.name, ruleObject, prepared.stopProcessing = rule.RuleName, rule.RuleObject, rule.StopProcessing
+		prepared.apply = func(alert *models.DbAlert) []string { return describeNotifyRule(alert, rule) }
+	default:
+		return nil, fmt.Errorf("ruleType must be one of alert, tag or notify")
+	}
+
+	group, err := ruleengine.ParseRuleObject(ruleObject)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ruleObject: %v", err)
+	}
+	prepared.group = group
+	return &prepared, nil
+}
+
+// testRule explains the evaluation of the rule against the alert and applies
+// its actions to the in-memory alert only. Tests are dry runs and do not count
+// in the rule engine metrics.
+func testRule(mongoClient *mongo.Client, request RuleTestRequest, alert *models.DbAlert) (RuleTestResponse, error) {
+	response := RuleTestResponse{RuleType: request.RuleType, Errors: []string{}, Actions: []string{}}
+
+	rule, err := prepareTestRule(mongoClient, request)
+	if err != nil {
+		return response, err
+	}
+	response.RuleName = rule.name
+
+	alertMap, err := alertToMap(alert)
+	if err != nil {
+		return response, fmt.Errorf("unable to convert alert to map: %v", err)
+	}
+
+	matched, trace, evalErr := ruleengine.EvaluateRulesGroupWithOptions(alertMap, rule.group, ruleengine.Options{Trace: true, DryRun: true})
+	if errs, ok := evalErr.(ruleengine.EvaluationErrors); ok {
+		for _, e := range errs {
+			response.Errors = append(response.Errors, e.Error())
+		}
+	}
+	response.Matched = matched
+	response.Trace = trace
+
+	if matched {
+		if actions := rule.apply(alert); actions != nil {
+			response.Actions = actions
+		}
+		if rule.stopProcessing {
+			response.Actions = append(response.Actions, fmt.Sprintf("stop processing later %s rules", request.RuleType))
+		}
+	}
+	response.Alert = *alert
+	return response, nil
+}
+
+// loadTestRule decodes the inline rule, or loads the stored rule by id.
+func loadTestRule(mongoClient *mongo.Client, request RuleTestRequest, rule interface{}) error {
+	if request.RuleId == "" {
+		if len(request.Rule) == 0 {
+			return fmt.Errorf("either ruleId or rule is required")
+		}
+		if err := json.Unmarshal(request.Rule, rule); err != nil {
+			return fmt.Errorf("invalid rule: %v", err)
+		}
+		return nil
+	}
+
+	id, err := primitive.ObjectIDFromHex(request.RuleId)
+	if err != nil {
+		return fmt.Errorf("invalid ruleId: %v", err)
+	}
+	collection := mongoClient.Database(mongodatabase).Collection(ruleTypeCollections[request.RuleType])
+	if err := collection.FindOne(context.TODO(), bson.M{"_id": id}).Decode(rule); err != nil {
+		return fmt.Errorf("rule %s not found: %v", request.RuleId, err)
+	}
+	return nil
+}
+
+// describeNotifyRule reports what a matched notify rule would do for the
+// alert, mirroring processNotifyRules without sending anything.
+func describeNotifyRule(alert *models.DbAlert, notifyRule models.DbNotifyRule) []string {
+	actions := []string{fmt.Sprintf("set alertdestination = %q", notifyRule.RuleName)}
+	alert.AlertDestination = notifyRule.RuleName
+
+	if alert.Grouped && !alert.Parent && alert.GroupIncidentId != "" {
+		return append(actions, fmt.Sprintf("add note to the PagerDuty incident of parent %s", alert.GroupIncidentId))
+	}
+	return append(actions, fmt.Sprintf("create PagerDuty incident (service %q, escalation policy %q)",
+		notifyRule.PagerDutyService, notifyRule.PagerDutyEscalationPolicy))
+}
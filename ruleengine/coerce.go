@@ -0,0 +1,89 @@
+package ruleengine
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// timeLayouts are the date formats accepted for date rules and date tags.
+var timeLayouts = []string{
+	"2006-01-02 15:04:05",
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+}
+
+// inferType picks the rule type from the field value when the rule does not
+// carry one, as react-querybuilder rules often don't.
+func inferType(v interface{}) string {
+	switch v.(type) {
+	case float64, float32, int, int32, int64:
+		return "number"
+	case time.Time, interface{ UTC() time.Time }:
+		return "date"
+	}
+	return "string"
+}
+
+// toStringValue converts scalar values to their string form. Lists and maps
+// cannot be compared as strings and return ErrTypeMismatch.
+func toStringValue(v interface{}) (string, error) {
+	switch val := v.(type) {
+	case string:
+		return val, nil
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64), nil
+	case float32:
+		return strconv.FormatFloat(float64(val), 'f', -1, 32), nil
+	case int, int32, int64, bool:
+		return fmt.Sprintf("%v", val), nil
+	case nil:
+		return "", nil
+	}
+	return "", fmt.Errorf("%w: %T is not a string", ErrTypeMismatch, v)
+}
+
+// toTime converts strings, time.Time and types embedding time.Time (such as
+// models.CustomTime) to a time.Time.
+func toTime(v interface{}) (time.Time, error) {
+	switch val := v.(type) {
+	case time.Time:
+		return val, nil
+	case interface{ UTC() time.Time }:
+		return val.UTC(), nil
+	case string:
+		return parseTime(val)
+	}
+	return time.Time{}, fmt.Errorf("%w: %T is not a date", ErrTypeMismatch, v)
+}
+
+func parseTime(s string) (time.Time, error) {
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%w: %q is not a date", ErrTypeMismatch, s)
+}
+
+// parseOffset parses a duration such as "10m", "1h30m", "-2h", "3d" or "1w".
+// Days and weeks are accepted on top of the time.ParseDuration units.
+func parseOffset(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if number, found := strings.CutSuffix(s, suffix); found {
+			n, err := strconv.ParseFloat(number, 64)
+			if err != nil {
+				return 0, fmt.Errorf("%w: invalid offset %q", ErrInvalidValue, s)
+			}
+			return time.Duration(n * float64(unit)), nil
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("%w: invalid offset %q", ErrInvalidValue, s)
+	}
+	return d, nil
+}
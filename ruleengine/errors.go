@@ -0,0 +1,91 @@
+package ruleengine
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Sentinel errors wrapped by RuleError, usable with errors.Is.
+var (
+	ErrTypeMismatch    = errors.New("type mismatch")
+	ErrInvalidValue    = errors.New("invalid rule value")
+	ErrInvalidRegex    = errors.New("invalid regex")
+	ErrUnknownOperator = errors.New("unknown operator")
+	ErrUnknownType     = errors.New("unknown rule type")
+)
+
+// RuleError describes why a single rule could not be evaluated.
+type RuleError struct {
+	Field    string
+	Type     string
+	Operator string
+	Err      error
+}
+
+func (e *RuleError) Error() string {
+	return fmt.Sprintf("rule %s %s (%s): %v", e.Field, e.Operator, e.Type, e.Err)
+}
+
+func (e *RuleError) Unwrap() error {
+	return e.Err
+}
+
+// EvaluationErrors collects the rule errors of one group evaluation.
+type EvaluationErrors []*RuleError
+
+func (e EvaluationErrors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, err := range e {
+		messages = append(messages, err.Error())
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Metrics is a snapshot of the rule evaluation counters.
+type Metrics struct {
+	Evaluations int64            `json:"evaluations"`
+	Matches     int64            `json:"matches"`
+	Errors      int64            `json:"errors"`
+	ErrorsBy    map[string]int64 `json:"errors_by_kind"`
+}
+
+var metricsMutex sync.Mutex
+var metrics = Metrics{ErrorsBy: make(map[string]int64)}
+
+func recordEvaluation(matched bool, err error) {
+	metricsMutex.Lock()
+	defer metricsMutex.Unlock()
+
+	metrics.Evaluations++
+	if matched {
+		metrics.Matches++
+	}
+	if err != nil {
+		metrics.Errors++
+		metrics.ErrorsBy[errorKind(err)]++
+	}
+}
+
+func errorKind(err error) string {
+	for _, sentinel := range []error{ErrTypeMismatch, ErrInvalidValue, ErrInvalidRegex, ErrUnknownOperator, ErrUnknownType} {
+		if errors.Is(err, sentinel) {
+			return sentinel.Error()
+		}
+	}
+	return "other"
+}
+
+// GetMetrics returns a copy of the rule evaluation counters.
+func GetMetrics() Metrics {
+	metricsMutex.Lock()
+	defer metricsMutex.Unlock()
+
+	snapshot := metrics
+	snapshot.ErrorsBy = make(map[string]int64, len(metrics.ErrorsBy))
+	for kind, count := range metrics.ErrorsBy {
+		snapshot.ErrorsBy[kind] = count
+	}
+	return snapshot
+}
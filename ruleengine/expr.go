@@ -0,0 +1,380 @@
+package ruleengine
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ParseExpression compiles a rule written as an expression, e.g.
+//
+//	severity == "critical" && additionaldetails.env in ["prod","dr"] && alertcount > 5
+//
+// into the equivalent RulesGroup, so expressions are evaluated, explained and
+// validated exactly like query-builder rules. Supported syntax:
+//
+//   - && / and, || / or, ! / not and parentheses
+//   - comparisons ==, !=, <, <=, >, >=, =~ (regex) and !~ (not regex)
+//   - in / not in with a [list]
+//   - any rule operator as a word, e.g. summary containsIgnoreCase "disk"
+//   - == null / != null, and a bare field meaning "is set"
+//
+// The left side of a comparison is a field path, the right side a string,
+// number, boolean, null or list literal.
+func ParseExpression(expression string) (RulesGroup, error) {
+	tokens, err := tokenizeExpression(expression)
+	if err != nil {
+		return RulesGroup{}, err
+	}
+	p := &exprParser{tokens: tokens}
+	node, err := p.parseOr()
+	if err != nil {
+		return RulesGroup{}, err
+	}
+	if tok := p.peek(); tok.kind != tokenEOF {
+		return RulesGroup{}, p.errorf(tok, "unexpected %q", tok.text)
+	}
+	if group, ok := node.(RulesGroup); ok {
+		return group, nil
+	}
+	return RulesGroup{Condition: "and", Rules: []interface{}{node}}, nil
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenString
+	tokenNumber
+	tokenSymbol
+)
+
+type exprToken struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+var exprSymbols = []string{"&&", "||", "==", "!=", "<=", ">=", "=~", "!~", "<", ">", "!", "(", ")", "[", "]", ",", "="}
+
+func tokenizeExpression(input string) ([]exprToken, error) {
+	var tokens []exprToken
+	i := 0
+	for i < len(input) {
+		c := rune(input[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '"' || c == '\'':
+			end := i + 1
+			for end < len(input) && input[end] != byte(c) {
+				if input[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(input) {
+				return nil, fmt.Errorf("expression: unterminated string at position %d", i+1)
+			}
+			text := input[i+1 : end]
+			if c == '"' {
+				unquoted, err := strconv.Unquote(input[i : end+1])
+				if err != nil {
+					return nil, fmt.Errorf("expression: invalid string at position %d: %v", i+1, err)
+				}
+				text = unquoted
+			} else {
+				text = strings.ReplaceAll(text, `\'`, `'`)
+			}
+			tokens = append(tokens, exprToken{tokenString, text, i + 1})
+			i = end + 1
+		case unicode.IsDigit(c) || (c == '-' && i+1 < len(input) && unicode.IsDigit(rune(input[i+1]))):
+			end := i + 1
+			for end < len(input) && (unicode.IsDigit(rune(input[end])) || input[end] == '.') {
+				end++
+			}
+			tokens = append(tokens, exprToken{tokenNumber, input[i:end], i + 1})
+			i = end
+		case unicode.IsLetter(c) || c == '_':
+			end := i + 1
+			for end < len(input) && (unicode.IsLetter(rune(input[end])) || unicode.IsDigit(rune(input[end])) || input[end] == '_' || input[end] == '.') {
+				end++
+			}
+			tokens = append(tokens, exprToken{tokenIdent, input[i:end], i + 1})
+			i = end
+		default:
+			matched := false
+			for _, symbol := range exprSymbols {
+				if strings.HasPrefix(input[i:], symbol) {
+					tokens = append(tokens, exprToken{tokenSymbol, symbol, i + 1})
+					i += len(symbol)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("expression: unexpected character %q at position %d", c, i+1)
+			}
+		}
+	}
+	return append(tokens, exprToken{kind: tokenEOF, pos: len(input) + 1}), nil
+}
+
+type exprParser struct {
+	tokens []exprToken
+	pos    int
+}
+
+func (p *exprParser) peek() exprToken {
+	return p.tokens[p.pos]
+}
+
+func (p *exprParser) next() exprToken {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokenEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *exprParser) errorf(tok exprToken, format string, args ...interface{}) error {
+	if tok.kind == tokenEOF {
+		return fmt.Errorf("expression: %s at end of input", fmt.Sprintf(format, args...))
+	}
+	return fmt.Errorf("expression: %s at position %d", fmt.Sprintf(format, args...), tok.pos)
+}
+
+// is matches a symbol or a case-insensitive keyword.
+func (tok exprToken) is(texts ...string) bool {
+	for _, text := range texts {
+		if tok.kind == tokenSymbol && tok.text == text {
+			return true
+		}
+		if tok.kind == tokenIdent && strings.EqualFold(tok.text, text) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *exprParser) parseOr() (interface{}, error) {
+	return p.parseBinary("or", []string{"||", "or"}, p.parseAnd)
+}
+
+func (p *exprParser) parseAnd() (interface{}, error) {
+	return p.parseBinary("and", []string{"&&", "and"}, p.parseUnary)
+}
+
+// parseBinary collects a chain of operands joined by the same combinator
+// into one group.
+func (p *exprParser) parseBinary(combinator string, operators []string, operand func() (interface{}, error)) (interface{}, error) {
+	first, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	if !p.peek().is(operators...) {
+		return first, nil
+	}
+	group := RulesGroup{Condition: combinator, Rules: []interface{}{first}}
+	for p.peek().is(operators...) {
+		p.next()
+		node, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		group.Rules = append(group.Rules, node)
+	}
+	return group, nil
+}
+
+func (p *exprParser) parseUnary() (interface{}, error) {
+	if p.peek().is("!", "not") {
+		p.next()
+		node, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if group, ok := node.(RulesGroup); ok {
+			group.Not = !group.Not
+			return group, nil
+		}
+		return RulesGroup{Condition: "and", Not: true, Rules: []interface{}{node}}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (interface{}, error) {
+	tok := p.peek()
+	if tok.is("(") {
+		p.next()
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); !closing.is(")") {
+			return nil, p.errorf(closing, "expected )")
+		}
+		return node, nil
+	}
+	return p.parseComparison()
+}
+
+// symbolOperators maps comparison symbols to rule operators.
+var symbolOperators = map[string]string{
+	"==": "=", "=": "=", "!=": "!=", "<": "<", "<=": "<=", ">": ">", ">=": ">=",
+	"=~": "regex", "!~": "notRegex",
+}
+
+// flippedOperators is used when the literal is written on the left.
+var flippedOperators = map[string]string{
+	"=": "=", "!=": "!=", "<": ">", "<=": ">=", ">": "<", ">=": "<=",
+}
+
+func (p *exprParser) parseComparison() (interface{}, error) {
+	left := p.next()
+	if left.kind == tokenEOF || left.kind == tokenSymbol {
+		return nil, p.errorf(left, "expected a field")
+	}
+
+	// A literal on the left, as in 5 < alertcount.
+	if left.kind != tokenIdent || isLiteralKeyword(left.text) {
+		value, err := literalValue(left)
+		if err != nil {
+			return nil, p.errorf(left, "%v", err)
+		}
+		opToken := p.next()
+		operator, ok := flippedOperators[symbolOperators[opToken.text]]
+		if opToken.kind != tokenSymbol || !ok {
+			return nil, p.errorf(opToken, "expected a comparison after literal")
+		}
+		field := p.next()
+		if field.kind != tokenIdent || isLiteralKeyword(field.text) {
+			return nil, p.errorf(field, "expected a field")
+		}
+		return comparisonRule(field.text, operator, value), nil
+	}
+
+	field := left.text
+	opToken := p.peek()
+	var operator string
+	switch {
+	case opToken.kind == tokenSymbol && symbolOperators[opToken.text] != "":
+		operator = symbolOperators[opToken.text]
+	case opToken.is("in"):
+		operator = "in"
+	case opToken.is("not") && p.tokens[p.pos+1].is("in"):
+		p.next()
+		operator = "notIn"
+	case opToken.kind == tokenIdent && isRuleOperator(opToken.text):
+		operator = opToken.text
+	default:
+		// A bare field is true when it is set.
+		return Rule{Field: field, Operator: "notNull"}, nil
+	}
+	p.next()
+
+	canonical, _ := normalizeOperator(operator)
+	if canonical == "null" || canonical == "notNull" {
+		return Rule{Field: field, Operator: canonical}, nil
+	}
+
+	valueToken := p.peek()
+	var value interface{}
+	var err error
+	if valueToken.is("[") {
+		if value, err = p.parseList(); err != nil {
+			return nil, err
+		}
+	} else {
+		p.next()
+		if value, err = literalValue(valueToken); err != nil {
+			return nil, p.errorf(valueToken, "%v", err)
+		}
+	}
+
+	if value == nil {
+		switch canonical {
+		case "=":
+			return Rule{Field: field, Operator: "null"}, nil
+		case "!=":
+			return Rule{Field: field, Operator: "notNull"}, nil
+		}
+		return nil, p.errorf(valueToken, "null can only be compared with == or !=")
+	}
+	return comparisonRule(field, operator, value), nil
+}
+
+func (p *exprParser) parseList() ([]interface{}, error) {
+	p.next() // [
+	list := []interface{}{}
+	for !p.peek().is("]") {
+		tok := p.next()
+		value, err := literalValue(tok)
+		if err != nil {
+			return nil, p.errorf(tok, "%v", err)
+		}
+		list = append(list, value)
+		if p.peek().is(",") {
+			p.next()
+		} else if !p.peek().is("]") {
+			return nil, p.errorf(p.peek(), "expected , or ]")
+		}
+	}
+	p.next() // ]
+	return list, nil
+}
+
+// comparisonRule builds the rule for a comparison. Numeric literals compare
+// numerically, everything else by the type of the field value.
+func comparisonRule(field string, operator string, value interface{}) Rule {
+	rule := Rule{Field: field, Operator: operator, Value: value}
+	if _, isNumber := value.(float64); isNumber {
+		switch operator {
+		case "<", "<=", ">", ">=":
+			rule.Type = "number"
+		}
+	}
+	return rule
+}
+
+func isRuleOperator(word string) bool {
+	canonical, _ := normalizeOperator(word)
+	_, ok := operatorAliases[canonical]
+	return ok
+}
+
+func isLiteralKeyword(word string) bool {
+	switch strings.ToLower(word) {
+	case "true", "false", "null":
+		return true
+	}
+	return false
+}
+
+func literalValue(tok exprToken) (interface{}, error) {
+	switch tok.kind {
+	case tokenString:
+		return tok.text, nil
+	case tokenNumber:
+		f, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", tok.text)
+		}
+		return f, nil
+	case tokenIdent:
+		switch strings.ToLower(tok.text) {
+		case "true":
+			return "true", nil
+		case "false":
+			return "false", nil
+		case "null":
+			return nil, nil
+		}
+		return nil, fmt.Errorf("expected a value, got field %q", tok.text)
+	case tokenEOF:
+		return nil, fmt.Errorf("expected a value")
+	}
+	return nil, fmt.Errorf("expected a value, got %q", tok.text)
+}
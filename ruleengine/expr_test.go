@@ -0,0 +1,217 @@
+package ruleengine
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseExpression(t *testing.T) {
+	and := func(rules ...interface{}) RulesGroup { return RulesGroup{Condition: "and", Rules: rules} }
+	or := func(rules ...interface{}) RulesGroup { return RulesGroup{Condition: "or", Rules: rules} }
+	not := func(group RulesGroup) RulesGroup { group.Not = true; return group }
+
+	tests := []struct {
+		name       string
+		expression string
+		want       RulesGroup
+	}{
+		{
+			name:       "single comparison",
+			expression: `severity == "critical"`,
+			want:       and(Rule{Field: "severity", Operator: "=", Value: "critical"}),
+		},
+		{
+			name:       "keywords and symbols",
+			expression: `severity = 'critical' and entity != "db01"`,
+			want: and(
+				Rule{Field: "severity", Operator: "=", Value: "critical"},
+				Rule{Field: "entity", Operator: "!=", Value: "db01"},
+			),
+		},
+		{
+			name:       "and binds tighter than or",
+			expression: `a == "1" || b == "2" && c == "3"`,
+			want: or(
+				Rule{Field: "a", Operator: "=", Value: "1"},
+				and(
+					Rule{Field: "b", Operator: "=", Value: "2"},
+					Rule{Field: "c", Operator: "=", Value: "3"},
+				),
+			),
+		},
+		{
+			name:       "parentheses override precedence",
+			expression: `(a == "1" || b == "2") && c == "3"`,
+			want: and(
+				or(
+					Rule{Field: "a", Operator: "=", Value: "1"},
+					Rule{Field: "b", Operator: "=", Value: "2"},
+				),
+				Rule{Field: "c", Operator: "=", Value: "3"},
+			),
+		},
+		{
+			name:       "chained combinators share one group",
+			expression: `a == "1" or b == "2" || c == "3"`,
+			want: or(
+				Rule{Field: "a", Operator: "=", Value: "1"},
+				Rule{Field: "b", Operator: "=", Value: "2"},
+				Rule{Field: "c", Operator: "=", Value: "3"},
+			),
+		},
+		{
+			name:       "numeric comparison is typed as number",
+			expression: `alertcount > 5`,
+			want:       and(Rule{Field: "alertcount", Type: "number", Operator: ">", Value: float64(5)}),
+		},
+		{
+			name:       "numeric equality keeps the field type",
+			expression: `alertcount == 5`,
+			want:       and(Rule{Field: "alertcount", Operator: "=", Value: float64(5)}),
+		},
+		{
+			name:       "regex operators",
+			expression: `entity =~ "^db" && entity !~ "test$"`,
+			want: and(
+				Rule{Field: "entity", Operator: "regex", Value: "^db"},
+				Rule{Field: "entity", Operator: "notRegex", Value: "test$"},
+			),
+		},
+		{
+			name:       "in list",
+			expression: `additionaldetails.env in ["prod", "dr"]`,
+			want:       and(Rule{Field: "additionaldetails.env", Operator: "in", Value: []interface{}{"prod", "dr"}}),
+		},
+		{
+			name:       "not in is one operator",
+			expression: `env not in ["prod", "dr"]`,
+			want:       and(Rule{Field: "env", Operator: "notIn", Value: []interface{}{"prod", "dr"}}),
+		},
+		{
+			name:       "not before a field negates",
+			expression: `a && not b`,
+			want: and(
+				Rule{Field: "a", Operator: "notNull"},
+				not(and(Rule{Field: "b", Operator: "notNull"})),
+			),
+		},
+		{
+			name:       "literal on the left flips the operator",
+			expression: `5 < alertcount`,
+			want:       and(Rule{Field: "alertcount", Type: "number", Operator: ">", Value: float64(5)}),
+		},
+		{
+			name:       "literal on the left with greater or equal",
+			expression: `10 >= alertcount`,
+			want:       and(Rule{Field: "alertcount", Type: "number", Operator: "<=", Value: float64(10)}),
+		},
+		{
+			name:       "string literal on the left",
+			expression: `"critical" == severity`,
+			want:       and(Rule{Field: "severity", Operator: "=", Value: "critical"}),
+		},
+		{
+			name:       "equal null",
+			expression: `owner == null`,
+			want:       and(Rule{Field: "owner", Operator: "null"}),
+		},
+		{
+			name:       "not equal null",
+			expression: `owner != null`,
+			want:       and(Rule{Field: "owner", Operator: "notNull"}),
+		},
+		{
+			name:       "bare field is not null",
+			expression: `owner`,
+			want:       and(Rule{Field: "owner", Operator: "notNull"}),
+		},
+		{
+			name:       "booleans are string values",
+			expression: `acknowledged == true`,
+			want:       and(Rule{Field: "acknowledged", Operator: "=", Value: "true"}),
+		},
+		{
+			name:       "rule operator as a word",
+			expression: `summary containsIgnoreCase "disk"`,
+			want:       and(Rule{Field: "summary", Operator: "containsIgnoreCase", Value: "disk"}),
+		},
+		{
+			name:       "not applied to a rule",
+			expression: `!severity == "critical"`,
+			want:       not(and(Rule{Field: "severity", Operator: "=", Value: "critical"})),
+		},
+		{
+			name:       "not applied to a group",
+			expression: `!(a == "1" || b == "2")`,
+			want: not(or(
+				Rule{Field: "a", Operator: "=", Value: "1"},
+				Rule{Field: "b", Operator: "=", Value: "2"},
+			)),
+		},
+		{
+			name:       "double negation cancels",
+			expression: `not !(a == "1" || b == "2")`,
+			want: or(
+				Rule{Field: "a", Operator: "=", Value: "1"},
+				Rule{Field: "b", Operator: "=", Value: "2"},
+			),
+		},
+		{
+			name:       "not applied to a nested group",
+			expression: `c == "3" && !(a == "1" && b == "2")`,
+			want: and(
+				Rule{Field: "c", Operator: "=", Value: "3"},
+				not(and(
+					Rule{Field: "a", Operator: "=", Value: "1"},
+					Rule{Field: "b", Operator: "=", Value: "2"},
+				)),
+			),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseExpression(tt.expression)
+			if err != nil {
+				t.Fatalf("ParseExpression(%q) error: %v", tt.expression, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseExpression(%q)\n got %#v\nwant %#v", tt.expression, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseExpressionErrors(t *testing.T) {
+	tests := []struct {
+		expression string
+		want       string
+	}{
+		{``, "expression: expected a field at end of input"},
+		{`severity ==`, "expression: expected a value at end of input"},
+		{`severity == "critical`, "expression: unterminated string at position 13"},
+		{`severity ~ "critical"`, `expression: unexpected character '~' at position 10`},
+		{`(a == "1"`, "expression: expected ) at end of input"},
+		{`a == "1")`, `expression: unexpected ")" at position 9`},
+		{`a == "1" b`, `expression: unexpected "b" at position 10`},
+		{`env not ["prod"]`, `expression: unexpected "not" at position 5`},
+		{`== "critical"`, "expression: expected a field at position 1"},
+		{`a == b`, `expression: expected a value, got field "b" at position 6`},
+		{`a in ["x" "y"]`, "expression: expected , or ] at position 11"},
+		{`a > null`, "expression: null can only be compared with == or != at position 5"},
+		{`5 alertcount`, "expression: expected a comparison after literal at position 3"},
+		{`5 < 6`, "expression: expected a field at position 5"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			_, err := ParseExpression(tt.expression)
+			if err == nil {
+				t.Fatalf("ParseExpression(%q) succeeded, want error %q", tt.expression, tt.want)
+			}
+			if err.Error() != tt.want {
+				t.Errorf("ParseExpression(%q) error\n got %q\nwant %q", tt.expression, err.Error(), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,172 @@
+package ruleengine
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// operatorAliases maps the alternative operator names used by older rules
+// and by react-querybuilder onto one canonical name per comparison.
+var operatorAliases = map[string]string{
+	"=":                "=",
+	"==":               "=",
+	"equal":            "=",
+	"equals":           "=",
+	"!":                "!=",
+	"!=":               "!=",
+	"not_equal":        "!=",
+	"notEqual":         "!=",
+	"notEquals":        "!=",
+	"<":                "<",
+	"less":             "<",
+	"<=":               "<=",
+	"less_or_equal":    "<=",
+	">":                ">",
+	"greater":          ">",
+	">=":               ">=",
+	"greater_or_equal": ">=",
+	"contains":         "contains",
+	"doesNotContain":   "doesNotContain",
+	"not_contains":     "doesNotContain",
+	"beginsWith":       "beginsWith",
+	"begins_with":      "beginsWith",
+	"doesNotBeginWith": "doesNotBeginWith",
+	"not_begins_with":  "doesNotBeginWith",
+	"endsWith":         "endsWith",
+	"ends_with":        "endsWith",
+	"doesNotEndWith":   "doesNotEndWith",
+	"not_ends_with":    "doesNotEndWith",
+	"regex":            "regex",
+	"matches":          "regex",
+	"notRegex":         "notRegex",
+	"doesNotMatch":     "notRegex",
+	"in":               "in",
+	"notIn":            "notIn",
+	"not_in":           "notIn",
+	"between":          "between",
+	"notBetween":       "notBetween",
+	"not_between":      "notBetween",
+	"null":             "null",
+	"is_null":          "null",
+	"notNull":          "notNull",
+	"is_not_null":      "notNull",
+	// Relative date operators, compared against the time of evaluation.
+	"olderThan":         "olderThan",
+	"older_than":        "olderThan",
+	"within":            "within",
+	"newerThan":         "within",
+	"newer_than":        "within",
+	"betweenOffsets":    "betweenOffsets",
+	"between_offsets":   "betweenOffsets",
+	"notBetweenOffsets": "notBetweenOffsets",
+}
+
+// isRelativeDateOperator reports whether a canonical operator compares a
+// date with an offset from now. These treat the field as a date whatever its
+// stored type, so they work on string tags as well as time fields.
+func isRelativeDateOperator(operator string) bool {
+	switch operator {
+	case "olderThan", "within", "betweenOffsets", "notBetweenOffsets":
+		return true
+	}
+	return false
+}
+
+// normalizeOperator returns the canonical operator name and whether the
+// comparison is case-insensitive. Case-insensitive variants are written with
+// an "IgnoreCase" suffix, e.g. "containsIgnoreCase" or "inIgnoreCase".
+func normalizeOperator(operator string) (string, bool) {
+	ignoreCase := false
+	if base, found := strings.CutSuffix(operator, "IgnoreCase"); found {
+		operator, ignoreCase = base, true
+	}
+	if canonical, ok := operatorAliases[operator]; ok {
+		return canonical, ignoreCase
+	}
+	return operator, ignoreCase
+}
+
+// isNull reports whether a field value counts as empty for null / notNull.
+// Zero times count as empty, as unset alert dates such as AlertClearTime are
+// zero rather than missing.
+func isNull(v interface{}) bool {
+	switch val := v.(type) {
+	case nil:
+		return true
+	case string:
+		return val == ""
+	case time.Time:
+		return val.IsZero()
+	}
+	return false
+}
+
+// valueList returns the values of an in / notIn / between rule. Lists may be
+// JSON arrays or comma separated strings, as react-querybuilder emits both.
+func valueList(v interface{}) []string {
+	switch val := v.(type) {
+	case []interface{}:
+		list := make([]string, 0, len(val))
+		for _, item := range val {
+			list = append(list, fmt.Sprintf("%v", item))
+		}
+		return list
+	case []string:
+		return val
+	case string:
+		if val == "" {
+			return nil
+		}
+		parts := strings.Split(val, ",")
+		for i := range parts {
+			parts[i] = strings.TrimSpace(parts[i])
+		}
+		return parts
+	case nil:
+		return nil
+	}
+	return []string{fmt.Sprintf("%v", v)}
+}
+
+// toFloat converts numeric field and rule values to float64.
+func toFloat(v interface{}) (float64, bool) {
+	switch val := v.(type) {
+	case float64:
+		return val, true
+	case float32:
+		return float64(val), true
+	case int:
+		return float64(val), true
+	case int32:
+		return float64(val), true
+	case int64:
+		return float64(val), true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(val), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+var regexCache sync.Map
+
+// compileRegex compiles a rule pattern once and reuses it for later
+// evaluations.
+func compileRegex(pattern string, ignoreCase bool) (*regexp.Regexp, error) {
+	if ignoreCase {
+		pattern = "(?i)" + pattern
+	}
+	if re, ok := regexCache.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	regexCache.Store(pattern, re)
+	return re, nil
+}
@@ -0,0 +1,89 @@
+package ruleengine
+
+import (
+	"reflect"
+	"strings"
+)
+
+// additionalDetailsKey is the alert field holding the free form tags.
+const additionalDetailsKey = "additionaldetails"
+
+// ResolveField looks up a rule field in the alert data. Keys are matched
+// case-insensitively and dotted paths walk nested maps, so all of
+// "ServiceName", "servicename", "additionaldetails.region" and "labels.team"
+// resolve. A path that is not found at the top level is looked up again
+// inside AdditionalDetails, so tags can be referenced by their bare name.
+func ResolveField(data map[string]interface{}, path string) (interface{}, bool) {
+	if val, ok := data[path]; ok {
+		return val, true
+	}
+	if val, ok := resolvePath(data, path); ok {
+		return val, true
+	}
+
+	first, _, _ := strings.Cut(path, ".")
+	if strings.EqualFold(first, additionalDetailsKey) {
+		return nil, false
+	}
+	if details, ok := lookupKey(data, additionalDetailsKey); ok {
+		return resolvePath(details, path)
+	}
+	return nil, false
+}
+
+// resolvePath walks a dotted path through nested maps. At every level the
+// whole remaining path is tried as a key first, since tag names may contain
+// dots themselves (e.g. "k8s.namespace").
+func resolvePath(current interface{}, path string) (interface{}, bool) {
+	if val, ok := lookupKey(current, path); ok {
+		return val, true
+	}
+	for i := 0; i < len(path); i++ {
+		if path[i] != '.' {
+			continue
+		}
+		next, ok := lookupKey(current, path[:i])
+		if !ok {
+			continue
+		}
+		if val, ok := resolvePath(next, path[i+1:]); ok {
+			return val, true
+		}
+	}
+	return nil, false
+}
+
+// lookupKey finds key in any map with string keys, ignoring case when there
+// is no exact match.
+func lookupKey(m interface{}, key string) (interface{}, bool) {
+	if typed, ok := m.(map[string]interface{}); ok {
+		if val, ok := typed[key]; ok {
+			return val, true
+		}
+		for k, val := range typed {
+			if strings.EqualFold(k, key) {
+				return val, true
+			}
+		}
+		return nil, false
+	}
+
+	// Named map types such as bson.M or map[string]string tags.
+	rv := reflect.ValueOf(m)
+	if rv.Kind() != reflect.Map || rv.Type().Key().Kind() != reflect.String {
+		return nil, false
+	}
+	iter := rv.MapRange()
+	var found interface{}
+	matched := false
+	for iter.Next() {
+		k := iter.Key().String()
+		if k == key {
+			return iter.Value().Interface(), true
+		}
+		if !matched && strings.EqualFold(k, key) {
+			found, matched = iter.Value().Interface(), true
+		}
+	}
+	return found, matched
+}
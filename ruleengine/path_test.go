@@ -0,0 +1,106 @@
+package ruleengine
+
+import (
+	"testing"
+	"time"
+)
+
+// namedMap stands in for bson.M and other named map types.
+type namedMap map[string]interface{}
+
+func TestResolveField(t *testing.T) {
+	data := map[string]interface{}{
+		"ServiceName": "payments",
+		"Entity":      "db01",
+		"AdditionalDetails": map[string]interface{}{
+			"region":        "eu-west",
+			"k8s.namespace": "billing",
+			"labels": map[string]interface{}{
+				"team": "core",
+				"Tier": "1",
+			},
+			"owner":   namedMap{"name": "ops"},
+			"targets": map[string]string{"Primary": "db01"},
+			"entity":  "shadowed",
+			"empty":   nil,
+		},
+		"labels": namedMap{"team": "top"},
+	}
+
+	tests := []struct {
+		path  string
+		want  interface{}
+		found bool
+	}{
+		{"ServiceName", "payments", true},
+		{"servicename", "payments", true},
+		{"SERVICENAME", "payments", true},
+		{"AdditionalDetails.region", "eu-west", true},
+		{"additionaldetails.region", "eu-west", true},
+		{"additionaldetails.REGION", "eu-west", true},
+		{"additionaldetails.labels.team", "core", true},
+		{"additionaldetails.labels.tier", "1", true},
+		// Tag names may contain dots.
+		{"additionaldetails.k8s.namespace", "billing", true},
+		// Named map types and map[string]string.
+		{"additionaldetails.owner.name", "ops", true},
+		{"additionaldetails.targets.primary", "db01", true},
+		// Bare tag names fall back to AdditionalDetails.
+		{"region", "eu-west", true},
+		{"k8s.namespace", "billing", true},
+		{"owner.NAME", "ops", true},
+		// Top level fields win over tags of the same name.
+		{"entity", "db01", true},
+		{"labels.team", "top", true},
+		// A nil tag is found, with a nil value.
+		{"empty", nil, true},
+		// Not found.
+		{"missing", nil, false},
+		{"additionaldetails.missing", nil, false},
+		{"additionaldetails.region.sub", nil, false},
+		{"labels.missing", nil, false},
+		{"ServiceName.x", nil, false},
+		{"", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, found := ResolveField(data, tt.path)
+			if found != tt.found || got != tt.want {
+				t.Errorf("ResolveField(%q) = %#v, %v, want %#v, %v", tt.path, got, found, tt.want, tt.found)
+			}
+		})
+	}
+}
+
+func TestResolveFieldWithoutAdditionalDetails(t *testing.T) {
+	data := map[string]interface{}{"Entity": "db01"}
+	if got, found := ResolveField(data, "region"); found {
+		t.Errorf("ResolveField(region) = %#v, true, want not found", got)
+	}
+	if got, found := ResolveField(data, "additionaldetails"); found {
+		t.Errorf("ResolveField(additionaldetails) = %#v, true, want not found", got)
+	}
+}
+
+func TestEvaluateRuleResolvesPaths(t *testing.T) {
+	data := map[string]interface{}{
+		"AdditionalDetails": map[string]interface{}{"env": "prod", "cpu": float64(93)},
+	}
+	tests := []struct {
+		rule Rule
+		want bool
+	}{
+		{Rule{Field: "additionaldetails.env", Operator: "=", Value: "prod"}, true},
+		{Rule{Field: "env", Operator: "=", Value: "prod"}, true},
+		{Rule{Field: "ENV", Operator: "in", Value: "dev,prod"}, true},
+		{Rule{Field: "cpu", Operator: ">", Value: "90"}, true},
+		{Rule{Field: "additionaldetails.memory", Operator: "null"}, true},
+	}
+	for _, tt := range tests {
+		got, err := evaluateRule(data, tt.rule, time.Now())
+		if err != nil || got != tt.want {
+			t.Errorf("evaluateRule(%+v) = %v, %v, want %v", tt.rule, got, err, tt.want)
+		}
+	}
+}
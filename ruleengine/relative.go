@@ -0,0 +1,67 @@
+package ruleengine
+
+import (
+	"fmt"
+	"time"
+)
+
+// evaluateRelativeDateRule compares a date with offsets from now:
+//
+//	olderThan "10m"                   the date is more than 10 minutes ago
+//	within "1h"                       the date is at most 1 hour ago (or later)
+//	betweenOffsets ["-2h", "-30m"]    the date lies between now-2h and now-30m
+//
+// Offsets of betweenOffsets are signed, positive offsets lie in the future;
+// their order does not matter.
+func evaluateRelativeDateRule(fieldDate time.Time, operator string, value interface{}, now time.Time) (bool, error) {
+	bounds, err := relativeDateBounds(operator, value, now)
+	if err != nil {
+		return false, err
+	}
+	switch operator {
+	case "olderThan":
+		return fieldDate.Before(bounds[0]), nil
+	case "within":
+		return !fieldDate.Before(bounds[0]), nil
+	}
+	within := !fieldDate.Before(bounds[0]) && !fieldDate.After(bounds[1])
+	return within == (operator == "betweenOffsets"), nil
+}
+
+// relativeDateBounds resolves the offsets of a relative date rule to times.
+// olderThan and within take one duration counted back from now.
+func relativeDateBounds(operator string, value interface{}, now time.Time) ([2]time.Time, error) {
+	var bounds [2]time.Time
+	offsets := valueList(value)
+
+	switch operator {
+	case "olderThan", "within":
+		if len(offsets) != 1 {
+			return bounds, fmt.Errorf("%w: %s needs one duration like \"10m\"", ErrInvalidValue, operator)
+		}
+		d, err := parseOffset(offsets[0])
+		if err != nil {
+			return bounds, err
+		}
+		if d < 0 {
+			d = -d
+		}
+		bounds[0] = now.Add(-d)
+		return bounds, nil
+	}
+
+	if len(offsets) != 2 {
+		return bounds, fmt.Errorf("%w: %s needs two offsets like [\"-2h\", \"-30m\"]", ErrInvalidValue, operator)
+	}
+	for i, offset := range offsets {
+		d, err := parseOffset(offset)
+		if err != nil {
+			return bounds, err
+		}
+		bounds[i] = now.Add(d)
+	}
+	if bounds[0].After(bounds[1]) {
+		bounds[0], bounds[1] = bounds[1], bounds[0]
+	}
+	return bounds, nil
+}
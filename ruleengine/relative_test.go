@@ -0,0 +1,150 @@
+package ruleengine
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseOffset(t *testing.T) {
+	tests := []struct {
+		offset  string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"10m", 10 * time.Minute, false},
+		{"1h30m", 90 * time.Minute, false},
+		{"-2h", -2 * time.Hour, false},
+		{" 45s ", 45 * time.Second, false},
+		{"3d", 3 * 24 * time.Hour, false},
+		{"1.5d", 36 * time.Hour, false},
+		{"-1d", -24 * time.Hour, false},
+		{"2w", 14 * 24 * time.Hour, false},
+		{"d", 0, true},
+		{"xd", 0, true},
+		{"10", 0, true},
+		{"ten minutes", 0, true},
+		{"", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseOffset(tt.offset)
+		if tt.wantErr {
+			if !errors.Is(err, ErrInvalidValue) {
+				t.Errorf("parseOffset(%q) error = %v, want ErrInvalidValue", tt.offset, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("parseOffset(%q) = %v, %v, want %v", tt.offset, got, err, tt.want)
+		}
+	}
+}
+
+func TestRelativeDateBounds(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		operator string
+		value    interface{}
+		want     [2]time.Time
+		wantErr  bool
+	}{
+		{"olderThan", "10m", [2]time.Time{now.Add(-10 * time.Minute)}, false},
+		{"within", "1d", [2]time.Time{now.Add(-24 * time.Hour)}, false},
+		// The sign of a single duration does not matter.
+		{"within", "-1h", [2]time.Time{now.Add(-time.Hour)}, false},
+		{"olderThan", []interface{}{"2h"}, [2]time.Time{now.Add(-2 * time.Hour)}, false},
+		{"betweenOffsets", []interface{}{"-2h", "-30m"}, [2]time.Time{now.Add(-2 * time.Hour), now.Add(-30 * time.Minute)}, false},
+		// Bounds are ordered whatever order they are given in.
+		{"betweenOffsets", "-30m,-2h", [2]time.Time{now.Add(-2 * time.Hour), now.Add(-30 * time.Minute)}, false},
+		{"notBetweenOffsets", "-1h, 1h", [2]time.Time{now.Add(-time.Hour), now.Add(time.Hour)}, false},
+		{"olderThan", "", [2]time.Time{}, true},
+		{"olderThan", "1h,2h", [2]time.Time{}, true},
+		{"within", "soon", [2]time.Time{}, true},
+		{"betweenOffsets", "-1h", [2]time.Time{}, true},
+		{"betweenOffsets", "-1h,later", [2]time.Time{}, true},
+	}
+	for _, tt := range tests {
+		got, err := relativeDateBounds(tt.operator, tt.value, now)
+		if tt.wantErr {
+			if !errors.Is(err, ErrInvalidValue) {
+				t.Errorf("relativeDateBounds(%s, %v) error = %v, want ErrInvalidValue", tt.operator, tt.value, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("relativeDateBounds(%s, %v) = %v, %v, want %v", tt.operator, tt.value, got, err, tt.want)
+		}
+	}
+}
+
+func TestRelativeDateRules(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	data := map[string]interface{}{
+		"AlertFirstTime": now.Add(-3 * time.Hour),
+		"AlertLastTime":  now.Add(-5 * time.Minute),
+		"AlertClearTime": time.Time{},
+		"AdditionalDetails": map[string]interface{}{
+			"deployed_at": "2024-03-01 11:00:00",
+			"note":        "not a date",
+		},
+	}
+
+	tests := []struct {
+		name    string
+		rule    Rule
+		want    bool
+		wantErr error
+	}{
+		{"older than", Rule{Field: "AlertFirstTime", Operator: "olderThan", Value: "1h"}, true, nil},
+		{"not older than", Rule{Field: "AlertLastTime", Operator: "older_than", Value: "10m"}, false, nil},
+		{"within", Rule{Field: "AlertLastTime", Operator: "within", Value: "10m"}, true, nil},
+		{"newer than alias", Rule{Field: "AlertFirstTime", Operator: "newerThan", Value: "1h"}, false, nil},
+		{"within days", Rule{Field: "AlertFirstTime", Operator: "within", Value: "1d"}, true, nil},
+		{"between offsets", Rule{Field: "AlertFirstTime", Operator: "betweenOffsets", Value: []interface{}{"-4h", "-2h"}}, true, nil},
+		{"outside offsets", Rule{Field: "AlertLastTime", Operator: "betweenOffsets", Value: "-4h,-2h"}, false, nil},
+		{"not between offsets", Rule{Field: "AlertLastTime", Operator: "notBetweenOffsets", Value: "-4h,-2h"}, true, nil},
+		// Relative operators read string tags as dates, whatever the rule type.
+		{"string tag", Rule{Field: "deployed_at", Type: "string", Operator: "within", Value: "2h"}, true, nil},
+		{"string tag older", Rule{Field: "additionaldetails.deployed_at", Operator: "olderThan", Value: "2h"}, false, nil},
+		// An unset date is neither old nor recent.
+		{"zero time older than", Rule{Field: "AlertClearTime", Operator: "olderThan", Value: "1h"}, false, nil},
+		{"zero time within", Rule{Field: "AlertClearTime", Operator: "within", Value: "1h"}, false, nil},
+		{"zero time not between", Rule{Field: "AlertClearTime", Operator: "notBetweenOffsets", Value: "-1h,0s"}, false, nil},
+		{"missing field", Rule{Field: "resolved_at", Operator: "olderThan", Value: "1h"}, false, nil},
+		{"tag not a date", Rule{Field: "note", Operator: "within", Value: "1h"}, false, ErrTypeMismatch},
+		{"invalid offset", Rule{Field: "AlertFirstTime", Operator: "olderThan", Value: "an hour"}, false, ErrInvalidValue},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := evaluateRule(data, tt.rule, now)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("evaluateRule(%+v) error = %v, want %v", tt.rule, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("evaluateRule(%+v) = %v, %v, want %v", tt.rule, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvaluateRulesGroupNow(t *testing.T) {
+	firstSeen := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	data := map[string]interface{}{"AlertFirstTime": firstSeen.Add(-30 * time.Minute)}
+	group := RulesGroup{Condition: "and", Rules: []interface{}{
+		Rule{Field: "AlertFirstTime", Operator: "within", Value: "1h"},
+	}}
+
+	matched, _, err := EvaluateRulesGroupWithOptions(data, group, Options{DryRun: true, Now: firstSeen})
+	if err != nil || !matched {
+		t.Errorf("evaluated at %v = %v, %v, want a match", firstSeen, matched, err)
+	}
+	// Without Now the rule is evaluated against the current time.
+	matched, _, err = EvaluateRulesGroupWithOptions(data, group, Options{DryRun: true})
+	if err != nil || matched {
+		t.Errorf("evaluated now = %v, %v, want no match", matched, err)
+	}
+}
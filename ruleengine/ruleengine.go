@@ -3,7 +3,6 @@ package ruleengine
 import (
 	"encoding/json"
 	"fmt"
-	"strconv"
 	"strings"
 	"time"
 )
@@ -14,128 +13,560 @@ type Rule struct {
 	Type     string      `json:"type"`
 	Operator string      `json:"operator"`
 	Value    interface{} `json:"value"`
+
+	// schedule is Value compiled by ParseRuleObject for schedule rules.
+	schedule *compiledSchedule
 }
 
 // RulesGroup represents a group of rules.
+// Rules holds Rule and nested RulesGroup values, Not negates the whole group.
 type RulesGroup struct {
 	Condition string        `json:"combinator"`
+	Not       bool          `json:"not"`
 	Rules     []interface{} `json:"rules"`
 }
 
+// UnmarshalJSON decodes a react-querybuilder style group. Every entry of
+// "rules" that has its own "rules" list is decoded recursively as a nested
+// RulesGroup, anything else as a Rule. The older "condition": "AND" form is
+// accepted as well.
+func (g *RulesGroup) UnmarshalJSON(b []byte) error {
+	var raw struct {
+		Combinator string            `json:"combinator"`
+		Condition  string            `json:"condition"`
+		Not        bool              `json:"not"`
+		Rules      []json.RawMessage `json:"rules"`
+	}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+
+	g.Condition = strings.ToLower(raw.Combinator)
+	if g.Condition == "" {
+		g.Condition = strings.ToLower(raw.Condition)
+	}
+	if g.Condition == "" {
+		g.Condition = "and"
+	}
+	if g.Condition != "and" && g.Condition != "or" {
+		return fmt.Errorf("invalid combinator %q", g.Condition)
+	}
+	g.Not = raw.Not
+	g.Rules = make([]interface{}, 0, len(raw.Rules))
+
+	for i, item := range raw.Rules {
+		var probe map[string]json.RawMessage
+		if err := json.Unmarshal(item, &probe); err != nil {
+			return fmt.Errorf("rule %d is not an object: %v", i, err)
+		}
+		if _, isGroup := probe["rules"]; isGroup {
+			var group RulesGroup
+			if err := json.Unmarshal(item, &group); err != nil {
+				return fmt.Errorf("rule %d: %v", i, err)
+			}
+			g.Rules = append(g.Rules, group)
+			continue
+		}
+		var rule Rule
+		if err := json.Unmarshal(item, &rule); err != nil {
+			return fmt.Errorf("rule %d: %v", i, err)
+		}
+		g.Rules = append(g.Rules, rule)
+	}
+	return nil
+}
+
+// ParseRuleObject parses a RuleObject string as stored in the rule
+// collections: either query-builder JSON or an expression (see
+// ParseExpression). Schedule conditions are compiled once here, so the
+// parsed group can be evaluated repeatedly without re-reading their values.
+func ParseRuleObject(ruleObject string) (RulesGroup, error) {
+	var group RulesGroup
+	var err error
+	if trimmed := strings.TrimSpace(ruleObject); trimmed != "" && !strings.HasPrefix(trimmed, "{") {
+		group, err = ParseExpression(trimmed)
+	} else {
+		err = json.Unmarshal([]byte(ruleObject), &group)
+	}
+	if err != nil {
+		return group, err
+	}
+	compileSchedules(&group)
+	return group, nil
+}
+
 // EvaluateRule evaluates a single rule against the provided data.
-func EvaluateRule(data map[string]interface{}, rule Rule) bool {	
+// Field and rule values are coerced to the rule type where possible, a
+// *RuleError is returned when they cannot be (the rule then does not match).
+func EvaluateRule(data map[string]interface{}, rule Rule) (bool, error) {
+	return checkRule(data, rule, true, time.Now())
+}
+
+// checkRule evaluates a rule at now and wraps its error, counting it in the
+// package metrics when record is set.
+func checkRule(data map[string]interface{}, rule Rule, record bool, now time.Time) (bool, error) {
+	matched, err := evaluateRule(data, rule, now)
+	if record {
+		recordEvaluation(matched, err)
+	}
+	if err != nil {
+		return false, &RuleError{Field: rule.Field, Type: rule.Type, Operator: rule.Operator, Err: err}
+	}
+	return matched, nil
+}
+
+func evaluateRule(data map[string]interface{}, rule Rule, now time.Time) (bool, error) {
+	if rule.Type == "schedule" {
+		return evaluateScheduleRule(data, rule, now)
+	}
 
-	fieldValue, ok := data[rule.Field]
-	fmt.Println("I am here in Evaluvate Rule" , fieldValue ,ok,  rule.Field)
+	fieldValue, ok := ResolveField(data, rule.Field)
 
-	if !ok {
-		return false
+	operator, _ := normalizeOperator(rule.Operator)
+	switch operator {
+	case "null":
+		return !ok || isNull(fieldValue), nil
+	case "notNull":
+		return ok && !isNull(fieldValue), nil
 	}
 
-	switch rule.Type {
-	case "string":
+	if !ok || fieldValue == nil {
+		return false, nil
+	}
+
+	ruleType := rule.Type
+	if isRelativeDateOperator(operator) {
+		ruleType = "date"
+	} else if ruleType == "" {
+		ruleType = inferType(fieldValue)
+	}
 
-		return evaluateStringRule(fieldValue.(string), rule ,  data)
+	switch ruleType {
+	case "string", "text":
+		value, err := toStringValue(fieldValue)
+		if err != nil {
+			return false, err
+		}
+		return evaluateStringRule(value, rule)
 	case "integer":
-		return evaluateIntegerRule(fieldValue.(float64), rule ) // JSON numbers are decoded as float64
+		value, ok := toFloat(fieldValue)
+		if !ok {
+			return false, fmt.Errorf("%w: %T is not a number", ErrTypeMismatch, fieldValue)
+		}
+		return evaluateIntegerRule(value, rule)
+	case "number", "float", "double":
+		value, ok := toFloat(fieldValue)
+		if !ok {
+			return false, fmt.Errorf("%w: %T is not a number", ErrTypeMismatch, fieldValue)
+		}
+		return evaluateNumberRule(value, rule)
 	case "date":
-		return evaluateDateRule(fieldValue.(string), rule) // Assume date is a string
+		value, err := toTime(fieldValue)
+		if err != nil {
+			return false, err
+		}
+		// An unset date matches no date condition, like a missing field.
+		if value.IsZero() {
+			return false, nil
+		}
+		return evaluateDateRule(value, rule, now)
 	}
 
-	return false
+	return false, fmt.Errorf("%w: %q", ErrUnknownType, rule.Type)
 }
 
-func evaluateStringRule(fieldValue string, rule Rule, data map[string]interface{}) bool {
-	value := rule.Value.(string)
-	switch rule.Operator {
+func evaluateStringRule(fieldValue string, rule Rule) (bool, error) {
+	operator, ignoreCase := normalizeOperator(rule.Operator)
+
+	switch operator {
+	case "regex", "notRegex":
+		pattern, err := toStringValue(rule.Value)
+		if err != nil {
+			return false, fmt.Errorf("%w: regex must be a string", ErrInvalidValue)
+		}
+		re, err := compileRegex(pattern, ignoreCase)
+		if err != nil {
+			return false, fmt.Errorf("%w: %v", ErrInvalidRegex, err)
+		}
+		return re.MatchString(fieldValue) == (operator == "regex"), nil
+	case "in", "notIn":
+		found := false
+		for _, item := range valueList(rule.Value) {
+			if fieldValue == item || (ignoreCase && strings.EqualFold(fieldValue, item)) {
+				found = true
+				break
+			}
+		}
+		return found == (operator == "in"), nil
+	case "between", "notBetween":
+		bounds := valueList(rule.Value)
+		if len(bounds) != 2 {
+			return false, fmt.Errorf("%w: %s needs two values", ErrInvalidValue, operator)
+		}
+		if ignoreCase {
+			fieldValue, bounds[0], bounds[1] = strings.ToLower(fieldValue), strings.ToLower(bounds[0]), strings.ToLower(bounds[1])
+		}
+		within := fieldValue >= bounds[0] && fieldValue <= bounds[1]
+		return within == (operator == "between"), nil
+	}
+
+	value, err := toStringValue(rule.Value)
+	if err != nil {
+		return false, fmt.Errorf("%w: %v", ErrInvalidValue, err)
+	}
+	if ignoreCase {
+		fieldValue, value = strings.ToLower(fieldValue), strings.ToLower(value)
+	}
+	switch operator {
 	case "=":
-		return fieldValue == value
-	case "!":
-		return fieldValue != value
+		return fieldValue == value, nil
+	case "!=":
+		return fieldValue != value, nil
+	case "<":
+		return fieldValue < value, nil
+	case "<=":
+		return fieldValue <= value, nil
+	case ">":
+		return fieldValue > value, nil
+	case ">=":
+		return fieldValue >= value, nil
 	case "contains":
-		
-		return strings.Contains(fieldValue, value)
-	case "not_contains":
-		return !strings.Contains(fieldValue, value)
+		return strings.Contains(fieldValue, value), nil
+	case "doesNotContain":
+		return !strings.Contains(fieldValue, value), nil
 	case "beginsWith":
-		return strings.HasPrefix(fieldValue, value)
+		return strings.HasPrefix(fieldValue, value), nil
 	case "endsWith":
-		return strings.HasSuffix(fieldValue, value)
-	case "doesNotContain":
-		return !strings.Contains(fieldValue, value)
+		return strings.HasSuffix(fieldValue, value), nil
 	case "doesNotBeginWith":
-		return !strings.HasPrefix(fieldValue, value)
+		return !strings.HasPrefix(fieldValue, value), nil
 	case "doesNotEndWith":
-		return !strings.HasSuffix(fieldValue, value)
+		return !strings.HasSuffix(fieldValue, value), nil
 	}
-	
-	return false
+
+	return false, fmt.Errorf("%w: %q for string", ErrUnknownOperator, rule.Operator)
 }
 
-func evaluateIntegerRule(fieldValue float64, rule Rule) bool {
-	value, err := strconv.Atoi(rule.Value.(string))
-	if err != nil {
-		return false
+// evaluateIntegerRule compares whole numbers, fractions are truncated on both
+// sides as integer rules always have.
+func evaluateIntegerRule(fieldValue float64, rule Rule) (bool, error) {
+	return compareNumbers(float64(int(fieldValue)), rule, func(f float64) float64 { return float64(int(f)) })
+}
+
+func evaluateNumberRule(fieldValue float64, rule Rule) (bool, error) {
+	return compareNumbers(fieldValue, rule, func(f float64) float64 { return f })
+}
+
+func compareNumbers(fieldValue float64, rule Rule, convert func(float64) float64) (bool, error) {
+	operator, _ := normalizeOperator(rule.Operator)
+
+	switch operator {
+	case "in", "notIn":
+		found := false
+		for _, item := range valueList(rule.Value) {
+			value, ok := toFloat(item)
+			if !ok {
+				return false, fmt.Errorf("%w: %q is not a number", ErrInvalidValue, item)
+			}
+			if fieldValue == convert(value) {
+				found = true
+				break
+			}
+		}
+		return found == (operator == "in"), nil
+	case "between", "notBetween":
+		bounds := valueList(rule.Value)
+		if len(bounds) != 2 {
+			return false, fmt.Errorf("%w: %s needs two values", ErrInvalidValue, operator)
+		}
+		low, ok1 := toFloat(bounds[0])
+		high, ok2 := toFloat(bounds[1])
+		if !ok1 || !ok2 {
+			return false, fmt.Errorf("%w: %v is not a numeric range", ErrInvalidValue, rule.Value)
+		}
+		within := fieldValue >= convert(low) && fieldValue <= convert(high)
+		return within == (operator == "between"), nil
 	}
-	fieldValueInt := int(fieldValue)
-	switch rule.Operator {
-	case "equal":
-		return fieldValueInt == value
-	case "not_equal":
-		return fieldValueInt != value
-	case "less":
-		return fieldValueInt < value
-	case "greater":
-		return fieldValueInt > value
 
+	value, ok := toFloat(rule.Value)
+	if !ok {
+		return false, fmt.Errorf("%w: %v is not a number", ErrInvalidValue, rule.Value)
+	}
+	value = convert(value)
+	switch operator {
+	case "=":
+		return fieldValue == value, nil
+	case "!=":
+		return fieldValue != value, nil
+	case "<":
+		return fieldValue < value, nil
+	case "<=":
+		return fieldValue <= value, nil
+	case ">":
+		return fieldValue > value, nil
+	case ">=":
+		return fieldValue >= value, nil
 	}
-	return false
+	return false, fmt.Errorf("%w: %q for number", ErrUnknownOperator, rule.Operator)
 }
 
-func evaluateDateRule(fieldValue string, rule Rule) bool {
-	value, err := time.Parse("2006-01-02 15:04:05", rule.Value.(string))
-	if err != nil {
-		return false
+func evaluateDateRule(fieldDate time.Time, rule Rule, now time.Time) (bool, error) {
+	operator, _ := normalizeOperator(rule.Operator)
+	if isRelativeDateOperator(operator) {
+		return evaluateRelativeDateRule(fieldDate, operator, rule.Value, now)
+	}
+	if operator == "between" || operator == "notBetween" {
+		bounds := valueList(rule.Value)
+		if len(bounds) != 2 {
+			return false, fmt.Errorf("%w: %s needs two values", ErrInvalidValue, operator)
+		}
+		low, err1 := parseTime(bounds[0])
+		high, err2 := parseTime(bounds[1])
+		if err1 != nil || err2 != nil {
+			return false, fmt.Errorf("%w: %v is not a date range", ErrInvalidValue, rule.Value)
+		}
+		within := !fieldDate.Before(low) && !fieldDate.After(high)
+		return within == (operator == "between"), nil
 	}
-	fieldDate, err := time.Parse("2006-01-02 15:04:05", fieldValue)
+
+	value, err := toTime(rule.Value)
 	if err != nil {
-		return false
+		return false, fmt.Errorf("%w: %v", ErrInvalidValue, err)
 	}
-	switch rule.Operator {
-	case "equal":
-		return fieldDate.Equal(value)
-	case "not_equal":
-		return !fieldDate.Equal(value)
-	case "less":
-		return fieldDate.Before(value)
-	case "greater":
-		return fieldDate.After(value)
+	switch operator {
+	case "=":
+		return fieldDate.Equal(value), nil
+	case "!=":
+		return !fieldDate.Equal(value), nil
+	case "<":
+		return fieldDate.Before(value), nil
+	case "<=":
+		return !fieldDate.After(value), nil
+	case ">":
+		return fieldDate.After(value), nil
+	case ">=":
+		return !fieldDate.Before(value), nil
 	}
-	return false
+	return false, fmt.Errorf("%w: %q for date", ErrUnknownOperator, rule.Operator)
 }
 
 // EvaluateRulesGroup evaluates a group of rules against the provided data.
-func EvaluateRulesGroup(data map[string]interface{}, group RulesGroup) bool {
+// Every rule is evaluated even when some fail; a failing rule counts as not
+// matched and its error is included in the returned EvaluationErrors.
+func EvaluateRulesGroup(data map[string]interface{}, group RulesGroup) (bool, error) {
+	result, _, err := EvaluateRulesGroupWithOptions(data, group, Options{})
+	return result, err
+}
 
-	result := group.Condition == "and"
+// ExplainRulesGroup evaluates a group like EvaluateRulesGroup and also
+// returns a trace of every condition, the value it resolved and its outcome.
+func ExplainRulesGroup(data map[string]interface{}, group RulesGroup) (bool, *Trace, error) {
+	return EvaluateRulesGroupWithOptions(data, group, Options{Trace: true})
+}
+
+// Options control how EvaluateRulesGroupWithOptions evaluates a group.
+type Options struct {
+	// Trace returns a trace of the evaluation, as ExplainRulesGroup does.
+	Trace bool
+	// DryRun keeps the evaluation out of the package metrics, for rule tests
+	// and backtests that must not count as production evaluations.
+	DryRun bool
+	// Now is the time relative dates and schedules are evaluated at, so
+	// backtests can replay alerts as of their arrival. Zero means time.Now().
+	Now time.Time
+}
+
+// EvaluateRulesGroupWithOptions evaluates a group like EvaluateRulesGroup.
+// The trace is nil unless options.Trace is set.
+func EvaluateRulesGroupWithOptions(data map[string]interface{}, group RulesGroup, options Options) (bool, *Trace, error) {
+	now := options.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+	e := &evaluator{data: data, tracing: options.Trace, dryRun: options.DryRun, now: now}
+	result, trace := e.group(group)
+	if len(e.errs) > 0 {
+		return result, trace, e.errs
+	}
+	return result, trace, nil
+}
+
+// Trace is one node of an explained evaluation: either a group with its
+// children or a single rule.
+type Trace struct {
+	Kind       string      `json:"kind"` // "group" or "rule"
+	Combinator string      `json:"combinator,omitempty"`
+	Not        bool        `json:"not,omitempty"`
+	Field      string      `json:"field,omitempty"`
+	Type       string      `json:"type,omitempty"`
+	Operator   string      `json:"operator,omitempty"`
+	Value      interface{} `json:"value,omitempty"`
+	Resolved   interface{} `json:"resolved,omitempty"`
+	Found      bool        `json:"found"`
+	Result     bool        `json:"result"`
+	Error      string      `json:"error,omitempty"`
+	Children   []*Trace    `json:"children,omitempty"`
+}
+
+// evaluator carries the state of one group evaluation.
+type evaluator struct {
+	data    map[string]interface{}
+	tracing bool
+	dryRun  bool
+	now     time.Time
+	errs    EvaluationErrors
+}
+
+func (e *evaluator) group(group RulesGroup) (bool, *Trace) {
+	condition := strings.ToLower(group.Condition)
+	if condition == "" {
+		condition = "and"
+	}
+
+	var trace *Trace
+	if e.tracing {
+		trace = &Trace{Kind: "group", Combinator: condition, Not: group.Not, Found: true}
+	}
+
+	result := condition == "and"
 	for _, ruleInterface := range group.Rules {
+		var matched bool
+		var child *Trace
 		switch rule := ruleInterface.(type) {
+		case Rule:
+			matched, child = e.rule(rule)
 		case map[string]interface{}:
-			var r Rule
 			ruleBytes, _ := json.Marshal(rule)
-			json.Unmarshal(ruleBytes, &r)
-			if group.Condition == "and" {
-				result = result && EvaluateRule(data, r)
-			} else if group.Condition == "or" {
-				result = result || EvaluateRule(data, r)
+			if _, isGroup := rule["rules"]; isGroup {
+				var g RulesGroup
+				if err := json.Unmarshal(ruleBytes, &g); err != nil {
+					e.errs = append(e.errs, &RuleError{Err: fmt.Errorf("%w: %v", ErrInvalidValue, err)})
+					continue
+				}
+				matched, child = e.group(g)
+			} else {
+				var r Rule
+				if err := json.Unmarshal(ruleBytes, &r); err != nil {
+					e.errs = append(e.errs, &RuleError{Err: fmt.Errorf("%w: %v", ErrInvalidValue, err)})
+					continue
+				}
+				matched, child = e.rule(r)
 			}
 		case RulesGroup:
-			if group.Condition == "and" {
-				result = result && EvaluateRulesGroup(data, rule)
-			} else if group.Condition == "or" {
-				result = result || EvaluateRulesGroup(data, rule)
+			matched, child = e.group(rule)
+		default:
+			continue
+		}
+		if trace != nil {
+			trace.Children = append(trace.Children, child)
+		}
+		if condition == "and" {
+			result = result && matched
+		} else if condition == "or" {
+			result = result || matched
+		}
+	}
+	if group.Not {
+		result = !result
+	}
+	if trace != nil {
+		trace.Result = result
+	}
+	return result, trace
+}
+
+func (e *evaluator) rule(rule Rule) (bool, *Trace) {
+	matched, err := checkRule(e.data, rule, !e.dryRun, e.now)
+	if err != nil {
+		e.errs = append(e.errs, err.(*RuleError))
+	}
+	if !e.tracing {
+		return matched, nil
+	}
+
+	trace := &Trace{
+		Kind:     "rule",
+		Field:    rule.Field,
+		Type:     rule.Type,
+		Operator: rule.Operator,
+		Value:    rule.Value,
+		Result:   matched,
+	}
+	trace.Resolved, trace.Found = ResolveField(e.data, rule.Field)
+	if err != nil {
+		trace.Error = err.(*RuleError).Err.Error()
+	}
+	return matched, trace
+}
+
+// ValidateRuleObject parses a RuleObject and checks every rule in it for a
+// field, a known type and operator, and a compilable regex, so broken rules
+// are rejected when they are saved rather than failing at evaluation time.
+func ValidateRuleObject(ruleObject string) error {
+	group, err := ParseRuleObject(ruleObject)
+	if err != nil {
+		return fmt.Errorf("invalid rule object: %v", err)
+	}
+	return validateGroup(group)
+}
+
+func validateGroup(group RulesGroup) error {
+	for _, ruleInterface := range group.Rules {
+		switch rule := ruleInterface.(type) {
+		case RulesGroup:
+			if err := validateGroup(rule); err != nil {
+				return err
 			}
+		case Rule:
+			if err := validateRule(rule); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func validateRule(rule Rule) error {
+	if rule.Type == "schedule" {
+		if operator, _ := normalizeOperator(rule.Operator); operator != "in" && operator != "notIn" && operator != "=" && operator != "!=" {
+			return fmt.Errorf("schedule rule: %w %q", ErrUnknownOperator, rule.Operator)
+		}
+		if _, err := parseSchedule(rule.Value); err != nil {
+			return fmt.Errorf("schedule rule: %w", err)
+		}
+		return nil
+	}
+	if rule.Field == "" {
+		return fmt.Errorf("rule with operator %q has no field", rule.Operator)
+	}
+	switch rule.Type {
+	case "", "string", "text", "integer", "number", "float", "double", "date":
+	default:
+		return fmt.Errorf("rule %s: %w %q", rule.Field, ErrUnknownType, rule.Type)
+	}
+
+	operator, ignoreCase := normalizeOperator(rule.Operator)
+	if _, ok := operatorAliases[operator]; !ok {
+		return fmt.Errorf("rule %s: %w %q", rule.Field, ErrUnknownOperator, rule.Operator)
+	}
+	if operator == "regex" || operator == "notRegex" {
+		pattern, err := toStringValue(rule.Value)
+		if err != nil {
+			return fmt.Errorf("rule %s: %w: regex must be a string", rule.Field, ErrInvalidValue)
+		}
+		if _, err := compileRegex(pattern, ignoreCase); err != nil {
+			return fmt.Errorf("rule %s: %w: %v", rule.Field, ErrInvalidRegex, err)
+		}
+	}
+	if operator == "between" || operator == "notBetween" {
+		if len(valueList(rule.Value)) != 2 {
+			return fmt.Errorf("rule %s: %w: %s needs two values", rule.Field, ErrInvalidValue, operator)
+		}
+	}
+	if isRelativeDateOperator(operator) {
+		if _, err := relativeDateBounds(operator, rule.Value, time.Now()); err != nil {
+			return fmt.Errorf("rule %s: %w", rule.Field, err)
 		}
 	}
-	return result
+	return nil
 }
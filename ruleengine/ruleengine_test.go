@@ -0,0 +1,277 @@
+package ruleengine
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+type embeddedTime struct {
+	time.Time
+}
+
+func TestEvaluateRule(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	data := map[string]interface{}{
+		"Entity":         "DB01.prod",
+		"AlertCount":     float64(7),
+		"Ratio":          2.5,
+		"Port":           int64(8080),
+		"Tags":           []interface{}{"a", "b"},
+		"Empty":          "",
+		"Missing":        nil,
+		"AlertFirstTime": time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC),
+		"AlertClearTime": time.Time{},
+		"Custom":         embeddedTime{time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		"StringDate":     "2024-02-15 08:00:00",
+	}
+
+	tests := []struct {
+		name    string
+		rule    Rule
+		want    bool
+		wantErr error
+	}{
+		// String operators and their aliases.
+		{"equal", Rule{Field: "Entity", Operator: "=", Value: "DB01.prod"}, true, nil},
+		{"equal alias", Rule{Field: "Entity", Operator: "equal", Value: "DB01.prod"}, true, nil},
+		{"equal is case sensitive", Rule{Field: "Entity", Operator: "=", Value: "db01.prod"}, false, nil},
+		{"not equal legacy", Rule{Field: "Entity", Operator: "!", Value: "db02"}, true, nil},
+		{"contains", Rule{Field: "Entity", Operator: "contains", Value: "01"}, true, nil},
+		{"not contains alias", Rule{Field: "Entity", Operator: "not_contains", Value: "01"}, false, nil},
+		{"begins with", Rule{Field: "Entity", Operator: "beginsWith", Value: "DB"}, true, nil},
+		{"begins with alias", Rule{Field: "Entity", Operator: "begins_with", Value: "db"}, false, nil},
+		{"ends with", Rule{Field: "Entity", Operator: "endsWith", Value: ".prod"}, true, nil},
+		{"does not end with", Rule{Field: "Entity", Operator: "doesNotEndWith", Value: ".prod"}, false, nil},
+		{"regex", Rule{Field: "Entity", Operator: "regex", Value: `^DB\d+`}, true, nil},
+		{"not regex", Rule{Field: "Entity", Operator: "doesNotMatch", Value: `^DB\d+`}, false, nil},
+		{"in list", Rule{Field: "Entity", Operator: "in", Value: []interface{}{"x", "DB01.prod"}}, true, nil},
+		{"in comma separated", Rule{Field: "Entity", Operator: "in", Value: "x, DB01.prod"}, true, nil},
+		{"not in", Rule{Field: "Entity", Operator: "notIn", Value: "x,y"}, true, nil},
+		{"string between", Rule{Field: "Entity", Operator: "between", Value: []interface{}{"DA", "DC"}}, true, nil},
+		{"string comparison", Rule{Field: "Entity", Operator: "<", Value: "E"}, true, nil},
+
+		// Case-insensitive variants.
+		{"equal ignore case", Rule{Field: "Entity", Operator: "=IgnoreCase", Value: "db01.PROD"}, true, nil},
+		{"contains ignore case", Rule{Field: "Entity", Operator: "containsIgnoreCase", Value: "PROD"}, true, nil},
+		{"alias ignore case", Rule{Field: "Entity", Operator: "begins_withIgnoreCase", Value: "db"}, true, nil},
+		{"in ignore case", Rule{Field: "Entity", Operator: "inIgnoreCase", Value: "x,db01.prod"}, true, nil},
+		{"not in ignore case", Rule{Field: "Entity", Operator: "notInIgnoreCase", Value: "db01.prod"}, false, nil},
+		{"regex ignore case", Rule{Field: "Entity", Operator: "regexIgnoreCase", Value: `^db`}, true, nil},
+		{"between ignore case", Rule{Field: "Entity", Operator: "betweenIgnoreCase", Value: "da,dc"}, true, nil},
+
+		// Numbers, with the rule value given as a string or a number.
+		{"number greater", Rule{Field: "AlertCount", Operator: ">", Value: "5"}, true, nil},
+		{"number greater alias", Rule{Field: "AlertCount", Operator: "greater", Value: float64(7)}, false, nil},
+		{"number less or equal", Rule{Field: "AlertCount", Operator: "less_or_equal", Value: 7}, true, nil},
+		{"number in", Rule{Field: "AlertCount", Operator: "in", Value: "1, 7"}, true, nil},
+		{"number between", Rule{Field: "Ratio", Operator: "between", Value: []interface{}{2, "3"}}, true, nil},
+		{"number not between", Rule{Field: "Ratio", Operator: "notBetween", Value: "2,3"}, false, nil},
+		{"int64 field", Rule{Field: "Port", Operator: "=", Value: "8080"}, true, nil},
+		{"integer truncates", Rule{Field: "Ratio", Type: "integer", Operator: "=", Value: "2.9"}, true, nil},
+		{"number keeps fractions", Rule{Field: "Ratio", Type: "number", Operator: "=", Value: "2"}, false, nil},
+		{"numeric string field", Rule{Field: "Entity", Type: "number", Operator: ">", Value: 1}, false, ErrTypeMismatch},
+		{"string rule on number", Rule{Field: "AlertCount", Type: "string", Operator: "=", Value: "7"}, true, nil},
+
+		// Dates from time.Time, embedded times and strings.
+		{"date after", Rule{Field: "AlertFirstTime", Operator: ">", Value: "2024-03-01 09:00:00"}, true, nil},
+		{"date rfc3339", Rule{Field: "AlertFirstTime", Operator: "=", Value: "2024-03-01T10:00:00Z"}, true, nil},
+		{"embedded time", Rule{Field: "Custom", Operator: "<", Value: "2024-02-02"}, true, nil},
+		{"string date", Rule{Field: "StringDate", Type: "date", Operator: "between", Value: "2024-02-01,2024-03-01"}, true, nil},
+		{"zero date matches nothing", Rule{Field: "AlertClearTime", Operator: "<", Value: "2030-01-01"}, false, nil},
+		{"zero date not equal", Rule{Field: "AlertClearTime", Operator: "!=", Value: "2030-01-01"}, false, nil},
+
+		// null and notNull.
+		{"null missing field", Rule{Field: "Nope", Operator: "null"}, true, nil},
+		{"null nil value", Rule{Field: "Missing", Operator: "is_null"}, true, nil},
+		{"null empty string", Rule{Field: "Empty", Operator: "null"}, true, nil},
+		{"null zero time", Rule{Field: "AlertClearTime", Operator: "null"}, true, nil},
+		{"not null set time", Rule{Field: "AlertFirstTime", Operator: "notNull"}, true, nil},
+		{"not null zero time", Rule{Field: "AlertClearTime", Operator: "is_not_null"}, false, nil},
+		{"not null string", Rule{Field: "Entity", Operator: "notNull"}, true, nil},
+
+		// Missing fields never match, even negated operators.
+		{"missing field", Rule{Field: "Nope", Operator: "!=", Value: "x"}, false, nil},
+		{"nil value", Rule{Field: "Missing", Operator: "doesNotContain", Value: "x"}, false, nil},
+
+		// Errors.
+		{"list as string", Rule{Field: "Tags", Operator: "=", Value: "a"}, false, ErrTypeMismatch},
+		{"invalid regex", Rule{Field: "Entity", Operator: "regex", Value: "("}, false, ErrInvalidRegex},
+		{"between needs two values", Rule{Field: "Entity", Operator: "between", Value: "a"}, false, ErrInvalidValue},
+		{"number value not numeric", Rule{Field: "AlertCount", Operator: ">", Value: "many"}, false, ErrInvalidValue},
+		{"number in not numeric", Rule{Field: "AlertCount", Operator: "in", Value: "1,x"}, false, ErrInvalidValue},
+		{"date value not a date", Rule{Field: "AlertFirstTime", Operator: ">", Value: "yesterday"}, false, ErrInvalidValue},
+		{"string date field not a date", Rule{Field: "Entity", Type: "date", Operator: ">", Value: "2024-01-01"}, false, ErrTypeMismatch},
+		{"unknown string operator", Rule{Field: "Entity", Operator: "sounds_like", Value: "x"}, false, ErrUnknownOperator},
+		{"unknown number operator", Rule{Field: "AlertCount", Operator: "contains", Value: "7"}, false, ErrUnknownOperator},
+		{"unknown type", Rule{Field: "Entity", Type: "color", Operator: "=", Value: "x"}, false, ErrUnknownType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := evaluateRule(data, tt.rule, now)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("evaluateRule(%+v) error = %v, want %v", tt.rule, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("evaluateRule(%+v) error: %v", tt.rule, err)
+			}
+			if got != tt.want {
+				t.Errorf("evaluateRule(%+v) = %v, want %v", tt.rule, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvaluateRulesGroupCollectsErrors(t *testing.T) {
+	data := map[string]interface{}{"Entity": "db01", "AlertCount": float64(3)}
+	group := RulesGroup{Condition: "or", Rules: []interface{}{
+		Rule{Field: "Entity", Operator: "regex", Value: "("},
+		map[string]interface{}{"field": "AlertCount", "operator": ">", "value": "2"},
+	}}
+
+	matched, _, err := EvaluateRulesGroupWithOptions(data, group, Options{DryRun: true})
+	if !matched {
+		t.Errorf("group did not match, want the second rule to match")
+	}
+	var evalErrs EvaluationErrors
+	if !errors.As(err, &evalErrs) || len(evalErrs) != 1 {
+		t.Fatalf("error = %v, want one EvaluationErrors entry", err)
+	}
+	if !errors.Is(evalErrs[0], ErrInvalidRegex) || evalErrs[0].Field != "Entity" {
+		t.Errorf("error = %v, want an invalid regex error on Entity", evalErrs[0])
+	}
+}
+
+func TestNormalizeOperator(t *testing.T) {
+	tests := []struct {
+		operator   string
+		want       string
+		ignoreCase bool
+	}{
+		{"==", "=", false},
+		{"not_equal", "!=", false},
+		{"containsIgnoreCase", "contains", true},
+		{"not_containsIgnoreCase", "doesNotContain", true},
+		{"newer_than", "within", false},
+		{"custom", "custom", false},
+		{"customIgnoreCase", "custom", true},
+	}
+	for _, tt := range tests {
+		got, ignoreCase := normalizeOperator(tt.operator)
+		if got != tt.want || ignoreCase != tt.ignoreCase {
+			t.Errorf("normalizeOperator(%q) = %q, %v, want %q, %v", tt.operator, got, ignoreCase, tt.want, tt.ignoreCase)
+		}
+	}
+}
+
+func TestCoercion(t *testing.T) {
+	floats := []struct {
+		in   interface{}
+		want float64
+		ok   bool
+	}{
+		{float64(1.5), 1.5, true},
+		{float32(2), 2, true},
+		{3, 3, true},
+		{int32(4), 4, true},
+		{int64(5), 5, true},
+		{" 6.5 ", 6.5, true},
+		{"six", 0, false},
+		{true, 0, false},
+		{nil, 0, false},
+	}
+	for _, tt := range floats {
+		got, ok := toFloat(tt.in)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("toFloat(%#v) = %v, %v, want %v, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+
+	strs := []struct {
+		in      interface{}
+		want    string
+		wantErr bool
+	}{
+		{"x", "x", false},
+		{float64(7), "7", false},
+		{2.25, "2.25", false},
+		{int64(8), "8", false},
+		{true, "true", false},
+		{nil, "", false},
+		{[]interface{}{"a"}, "", true},
+		{map[string]interface{}{"a": 1}, "", true},
+	}
+	for _, tt := range strs {
+		got, err := toStringValue(tt.in)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("toStringValue(%#v) = %q, %v, want %q, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+
+	want := time.Date(2024, 3, 1, 10, 30, 0, 0, time.UTC)
+	times := []struct {
+		in      interface{}
+		wantErr bool
+	}{
+		{want, false},
+		{embeddedTime{want}, false},
+		{"2024-03-01 10:30:00", false},
+		{"2024-03-01T10:30:00Z", false},
+		{"2024-03-01T10:30:00", false},
+		{"01/03/2024", true},
+		{float64(1709289000), true},
+	}
+	for _, tt := range times {
+		got, err := toTime(tt.in)
+		if tt.wantErr {
+			if !errors.Is(err, ErrTypeMismatch) {
+				t.Errorf("toTime(%#v) error = %v, want ErrTypeMismatch", tt.in, err)
+			}
+			continue
+		}
+		if err != nil || !got.Equal(want) {
+			t.Errorf("toTime(%#v) = %v, %v, want %v", tt.in, got, err, want)
+		}
+	}
+
+	types := []struct {
+		in   interface{}
+		want string
+	}{
+		{float64(1), "number"},
+		{int64(1), "number"},
+		{want, "date"},
+		{embeddedTime{want}, "date"},
+		{"2024-03-01", "string"},
+		{true, "string"},
+	}
+	for _, tt := range types {
+		if got := inferType(tt.in); got != tt.want {
+			t.Errorf("inferType(%#v) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestIsNull(t *testing.T) {
+	tests := []struct {
+		in   interface{}
+		want bool
+	}{
+		{nil, true},
+		{"", true},
+		{time.Time{}, true},
+		{" ", false},
+		{"x", false},
+		{float64(0), false},
+		{time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), false},
+	}
+	for _, tt := range tests {
+		if got := isNull(tt.in); got != tt.want {
+			t.Errorf("isNull(%#v) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,270 @@
+package ruleengine
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Schedule is the value of a rule of type "schedule". Every part that is set
+// must hold for the time to be in the schedule:
+//
+//	{"days": "mon-fri", "hours": "09:00-17:30", "timezone": "Europe/London"}
+//	{"calendar": "uk-bank-holidays", "timezone": "Europe/London"}
+//
+// Days and Hours take a comma separated string or a list of entries, ranges
+// may wrap around (e.g. "fri-mon", "22:00-06:00"). Hour ranges include their
+// start and exclude their end. Calendar names a holiday calendar registered
+// with SetHolidayCalendars.
+//
+// The rule's Field names the time to check, usually AlertFirstTime; without a
+// Field, or when the field is empty, the time of evaluation is used. The
+// operator is "in" or "notIn".
+type Schedule struct {
+	Days     interface{} `json:"days"`
+	Hours    interface{} `json:"hours"`
+	Timezone string      `json:"timezone"`
+	Calendar string      `json:"calendar"`
+}
+
+type compiledSchedule struct {
+	days     [7]bool
+	hours    [][2]int // minute of day ranges
+	location *time.Location
+	calendar string
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+var holidayCalendars atomic.Pointer[map[string]map[string]bool]
+
+// locations caches time.LoadLocation, which reads tzdata on every call.
+var locations sync.Map
+
+func loadLocation(name string) (*time.Location, error) {
+	if location, ok := locations.Load(name); ok {
+		return location.(*time.Location), nil
+	}
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, err
+	}
+	locations.Store(name, location)
+	return location, nil
+}
+
+// compileSchedules compiles the value of every schedule rule in the group.
+// Values that do not compile are left for evaluation to report.
+func compileSchedules(group *RulesGroup) {
+	for i, item := range group.Rules {
+		switch rule := item.(type) {
+		case RulesGroup:
+			compileSchedules(&rule)
+			group.Rules[i] = rule
+		case Rule:
+			if rule.Type == "schedule" {
+				if schedule, err := parseSchedule(rule.Value); err == nil {
+					rule.schedule = schedule
+					group.Rules[i] = rule
+				}
+			}
+		}
+	}
+}
+
+// SetHolidayCalendars replaces the holiday calendars available to schedule
+// rules. Each calendar is a list of dates in "2006-01-02" form.
+func SetHolidayCalendars(calendars map[string][]string) {
+	compiled := make(map[string]map[string]bool, len(calendars))
+	for name, dates := range calendars {
+		set := make(map[string]bool, len(dates))
+		for _, date := range dates {
+			set[strings.TrimSpace(date)] = true
+		}
+		compiled[name] = set
+	}
+	holidayCalendars.Store(&compiled)
+}
+
+func isHoliday(calendar string, date string) (bool, error) {
+	calendars := holidayCalendars.Load()
+	if calendars == nil {
+		return false, fmt.Errorf("%w: unknown holiday calendar %q", ErrInvalidValue, calendar)
+	}
+	dates, ok := (*calendars)[calendar]
+	if !ok {
+		return false, fmt.Errorf("%w: unknown holiday calendar %q", ErrInvalidValue, calendar)
+	}
+	return dates[date], nil
+}
+
+func evaluateScheduleRule(data map[string]interface{}, rule Rule, now time.Time) (bool, error) {
+	operator, _ := normalizeOperator(rule.Operator)
+	if operator != "in" && operator != "notIn" && operator != "=" && operator != "!=" {
+		return false, fmt.Errorf("%w: %q for schedule", ErrUnknownOperator, rule.Operator)
+	}
+
+	schedule := rule.schedule
+	if schedule == nil {
+		var err error
+		if schedule, err = parseSchedule(rule.Value); err != nil {
+			return false, err
+		}
+	}
+
+	at := now
+	if rule.Field != "" {
+		if fieldValue, ok := ResolveField(data, rule.Field); ok && !isNull(fieldValue) {
+			fieldTime, err := toTime(fieldValue)
+			if err != nil {
+				return false, err
+			}
+			if !fieldTime.IsZero() {
+				at = fieldTime
+			}
+		}
+	}
+
+	within, err := schedule.contains(at)
+	if err != nil {
+		return false, err
+	}
+	return within == (operator == "in" || operator == "="), nil
+}
+
+func (s *compiledSchedule) contains(at time.Time) (bool, error) {
+	local := at.In(s.location)
+	if !s.days[local.Weekday()] {
+		return false, nil
+	}
+
+	if len(s.hours) > 0 {
+		minute := local.Hour()*60 + local.Minute()
+		inHours := false
+		for _, r := range s.hours {
+			if r[0] <= r[1] {
+				inHours = minute >= r[0] && minute < r[1]
+			} else {
+				inHours = minute >= r[0] || minute < r[1]
+			}
+			if inHours {
+				break
+			}
+		}
+		if !inHours {
+			return false, nil
+		}
+	}
+
+	if s.calendar != "" {
+		return isHoliday(s.calendar, local.Format("2006-01-02"))
+	}
+	return true, nil
+}
+
+// parseSchedule decodes and checks a schedule rule value.
+func parseSchedule(value interface{}) (*compiledSchedule, error) {
+	var schedule Schedule
+	switch v := value.(type) {
+	case Schedule:
+		schedule = v
+	case string:
+		if err := json.Unmarshal([]byte(v), &schedule); err != nil {
+			return nil, fmt.Errorf("%w: schedule: %v", ErrInvalidValue, err)
+		}
+	default:
+		raw, err := json.Marshal(v)
+		if err == nil {
+			err = json.Unmarshal(raw, &schedule)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: schedule: %v", ErrInvalidValue, err)
+		}
+	}
+
+	compiled := &compiledSchedule{location: time.UTC, calendar: schedule.Calendar}
+	if schedule.Timezone != "" {
+		location, err := loadLocation(schedule.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("%w: timezone %q: %v", ErrInvalidValue, schedule.Timezone, err)
+		}
+		compiled.location = location
+	}
+
+	days := valueList(schedule.Days)
+	if len(days) == 0 {
+		compiled.days = [7]bool{true, true, true, true, true, true, true}
+	}
+	for _, entry := range days {
+		from, to, isRange := strings.Cut(entry, "-")
+		if !isRange {
+			to = from
+		}
+		start, ok1 := parseWeekday(from)
+		end, ok2 := parseWeekday(to)
+		if !ok1 || !ok2 {
+			return nil, fmt.Errorf("%w: invalid day %q", ErrInvalidValue, entry)
+		}
+		for day := start; ; day = (day + 1) % 7 {
+			compiled.days[day] = true
+			if day == end {
+				break
+			}
+		}
+	}
+
+	for _, entry := range valueList(schedule.Hours) {
+		from, to, isRange := strings.Cut(entry, "-")
+		if !isRange {
+			return nil, fmt.Errorf("%w: hours %q must be a range like 09:00-17:00", ErrInvalidValue, entry)
+		}
+		start, err1 := parseClock(from)
+		end, err2 := parseClock(to)
+		if err1 != nil || err2 != nil {
+			return nil, fmt.Errorf("%w: invalid hours %q", ErrInvalidValue, entry)
+		}
+		compiled.hours = append(compiled.hours, [2]int{start, end})
+	}
+
+	if len(days) == 0 && len(compiled.hours) == 0 && compiled.calendar == "" {
+		return nil, fmt.Errorf("%w: schedule needs days, hours or a calendar", ErrInvalidValue)
+	}
+	return compiled, nil
+}
+
+// parseWeekday accepts day names and their three letter abbreviations.
+func parseWeekday(name string) (time.Weekday, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if len(name) < 3 {
+		return 0, false
+	}
+	day, ok := weekdays[name[:3]]
+	return day, ok
+}
+
+// parseClock parses "9", "09:30" or "24:00" into minutes since midnight.
+func parseClock(clock string) (int, error) {
+	clock = strings.TrimSpace(clock)
+	hourPart, minutePart, hasMinutes := strings.Cut(clock, ":")
+	hour, err := strconv.Atoi(hourPart)
+	if err != nil {
+		return 0, err
+	}
+	minute := 0
+	if hasMinutes {
+		if minute, err = strconv.Atoi(minutePart); err != nil {
+			return 0, err
+		}
+	}
+	if hour < 0 || minute < 0 || minute > 59 || hour*60+minute > 24*60 {
+		return 0, fmt.Errorf("clock %q out of range", clock)
+	}
+	return hour*60 + minute, nil
+}
@@ -0,0 +1,177 @@
+package ruleengine
+
+import (
+	"errors"
+	"testing"
+	"time"
+	// The tests must not depend on the zoneinfo of the machine running them.
+	_ "time/tzdata"
+)
+
+func TestEvaluateScheduleRule(t *testing.T) {
+	SetHolidayCalendars(map[string][]string{
+		"uk-bank-holidays": {"2024-12-25", " 2024-12-26 "},
+	})
+
+	utc := func(value string) time.Time {
+		at, err := time.Parse("2006-01-02 15:04", value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return at
+	}
+	officeHours := map[string]interface{}{"days": "mon-fri", "hours": "09:00-17:30", "timezone": "Europe/London"}
+	nightShift := map[string]interface{}{"hours": []interface{}{"22:00-06:00"}, "timezone": "America/New_York"}
+	weekend := map[string]interface{}{"days": "sat,sun", "timezone": "Asia/Tokyo"}
+	longWeekend := map[string]interface{}{"days": "friday-monday"}
+
+	tests := []struct {
+		name     string
+		value    interface{}
+		operator string
+		at       time.Time
+		want     bool
+	}{
+		{"office hours in winter", officeHours, "in", utc("2024-01-08 09:00"), true},
+		{"before office hours in winter", officeHours, "in", utc("2024-01-08 08:59"), false},
+		// 08:30 UTC is 09:30 BST.
+		{"office hours in summer", officeHours, "in", utc("2024-07-01 08:30"), true},
+		// 17:00 UTC is 18:00 BST.
+		{"after office hours in summer", officeHours, "in", utc("2024-07-01 17:00"), false},
+		{"end of hours is excluded", officeHours, "in", utc("2024-01-08 17:30"), false},
+		{"weekend", officeHours, "in", utc("2024-01-06 12:00"), false},
+		{"not in office hours", officeHours, "notIn", utc("2024-01-06 12:00"), true},
+		{"not equal office hours", officeHours, "!=", utc("2024-01-08 12:00"), false},
+		{"json string value", `{"days": "mon-fri", "hours": "09:00-17:30", "timezone": "Europe/London"}`, "=", utc("2024-01-08 12:00"), true},
+		{"schedule value", Schedule{Days: "mon-fri", Hours: "9-17:30", Timezone: "Europe/London"}, "in", utc("2024-01-08 12:00"), true},
+
+		// 04:00 UTC is 23:00 EST the evening before.
+		{"hours wrap past midnight", nightShift, "in", utc("2024-01-10 04:00"), true},
+		{"hours wrap after midnight", nightShift, "in", utc("2024-01-10 10:59"), true},
+		{"outside wrapped hours", nightShift, "in", utc("2024-01-10 11:00"), false},
+
+		// 20:00 UTC on a Friday is already Saturday in Tokyo.
+		{"day in the schedule's time zone", weekend, "in", utc("2024-03-01 20:00"), true},
+		{"day before in the schedule's time zone", weekend, "in", utc("2024-03-01 14:00"), false},
+
+		{"days wrap around the week", longWeekend, "in", utc("2024-03-04 12:00"), true},
+		{"outside wrapped days", longWeekend, "in", utc("2024-03-06 12:00"), false},
+
+		{"holiday", map[string]interface{}{"calendar": "uk-bank-holidays"}, "in", utc("2024-12-25 12:00"), true},
+		{"holiday dates are trimmed", map[string]interface{}{"calendar": "uk-bank-holidays"}, "in", utc("2024-12-26 12:00"), true},
+		{"not a holiday", map[string]interface{}{"calendar": "uk-bank-holidays"}, "in", utc("2024-12-27 12:00"), false},
+		// 23:30 UTC on the 26th is the 27th in Auckland.
+		{"holiday over in the time zone", map[string]interface{}{"calendar": "uk-bank-holidays", "timezone": "Pacific/Auckland"}, "in", utc("2024-12-26 23:30"), false},
+		// 05:00 UTC on the 25th is still the 24th in Los Angeles.
+		{"holiday not yet in the time zone", map[string]interface{}{"calendar": "uk-bank-holidays", "timezone": "America/Los_Angeles"}, "in", utc("2024-12-25 05:00"), false},
+		{"holiday within hours", map[string]interface{}{"calendar": "uk-bank-holidays", "hours": "09:00-17:00"}, "in", utc("2024-12-25 18:00"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := map[string]interface{}{"AlertFirstTime": tt.at}
+			rule := Rule{Field: "AlertFirstTime", Type: "schedule", Operator: tt.operator, Value: tt.value}
+			got, err := evaluateRule(data, rule, time.Now())
+			if err != nil {
+				t.Fatalf("evaluateRule error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("schedule %v %s at %v = %v, want %v", tt.value, tt.operator, tt.at, got, tt.want)
+			}
+
+			// Rules compiled by ParseRuleObject must give the same result.
+			group := RulesGroup{Condition: "and", Rules: []interface{}{rule}}
+			compileSchedules(&group)
+			compiled := group.Rules[0].(Rule)
+			if compiled.schedule == nil {
+				t.Fatalf("schedule was not compiled")
+			}
+			if got, err := evaluateRule(data, compiled, time.Now()); err != nil || got != tt.want {
+				t.Errorf("compiled schedule = %v, %v, want %v", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvaluateScheduleRuleTime(t *testing.T) {
+	schedule := map[string]interface{}{"days": "mon-fri"}
+	monday := time.Date(2024, 1, 8, 12, 0, 0, 0, time.UTC)
+	saturday := time.Date(2024, 1, 6, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		field string
+		data  map[string]interface{}
+		now   time.Time
+		want  bool
+	}{
+		{"no field uses the evaluation time", "", nil, monday, true},
+		{"field time wins over the evaluation time", "AlertFirstTime", map[string]interface{}{"AlertFirstTime": saturday}, monday, false},
+		{"missing field uses the evaluation time", "AlertFirstTime", map[string]interface{}{}, monday, true},
+		{"zero field uses the evaluation time", "AlertClearTime", map[string]interface{}{"AlertClearTime": time.Time{}}, saturday, false},
+		{"string date field", "created", map[string]interface{}{"created": "2024-01-06 12:00:00"}, monday, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := Rule{Field: tt.field, Type: "schedule", Operator: "in", Value: schedule}
+			got, err := evaluateRule(tt.data, rule, tt.now)
+			if err != nil || got != tt.want {
+				t.Errorf("evaluateRule = %v, %v, want %v", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseScheduleErrors(t *testing.T) {
+	SetHolidayCalendars(map[string][]string{"uk-bank-holidays": {"2024-12-25"}})
+	now := time.Date(2024, 1, 8, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		value    interface{}
+		operator string
+		wantErr  error
+	}{
+		{"empty schedule", map[string]interface{}{"timezone": "UTC"}, "in", ErrInvalidValue},
+		{"unknown time zone", map[string]interface{}{"days": "mon", "timezone": "Mars/Olympus"}, "in", ErrInvalidValue},
+		{"unknown day", map[string]interface{}{"days": "mon-funday"}, "in", ErrInvalidValue},
+		{"short day", map[string]interface{}{"days": "mo"}, "in", ErrInvalidValue},
+		{"hours without range", map[string]interface{}{"hours": "09:00"}, "in", ErrInvalidValue},
+		{"hours out of range", map[string]interface{}{"hours": "09:00-25:00"}, "in", ErrInvalidValue},
+		{"minutes out of range", map[string]interface{}{"hours": "09:60-10:00"}, "in", ErrInvalidValue},
+		{"invalid json", `{"days": `, "in", ErrInvalidValue},
+		{"unknown calendar", map[string]interface{}{"calendar": "mars-holidays"}, "in", ErrInvalidValue},
+		{"unsupported operator", map[string]interface{}{"days": "mon"}, "contains", ErrUnknownOperator},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := Rule{Type: "schedule", Operator: tt.operator, Value: tt.value}
+			_, err := evaluateRule(nil, rule, now)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("evaluateRule(%v) error = %v, want %v", tt.value, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseClock(t *testing.T) {
+	tests := []struct {
+		clock   string
+		want    int
+		wantErr bool
+	}{
+		{"9", 9 * 60, false},
+		{"09:30", 9*60 + 30, false},
+		{" 17:05 ", 17*60 + 5, false},
+		{"24:00", 24 * 60, false},
+		{"24:01", 0, true},
+		{"-1", 0, true},
+		{"9am", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseClock(tt.clock)
+		if (err != nil) != tt.wantErr || (!tt.wantErr && got != tt.want) {
+			t.Errorf("parseClock(%q) = %d, %v, want %d, error %v", tt.clock, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+
+	"alertmanager/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// validatedRule is implemented by every rule model that can be saved through
+// the rules API.
+type validatedRule interface {
+	Validate() error
+}
+
+// ruleKinds maps the {kind} path segment of the rules API to a constructor
+// for a rule of that collection and for a list of them. Holiday calendars
+// and lookup tables are managed here as well since rules depend on them, and
+// runbooks since they are matched like rules.
+var ruleKinds = map[string]struct {
+	newRule func() validatedRule
+	newList func() interface{}
+}{
+	"alertrules": {
+		newRule: func() validatedRule { return &models.DbAlertRule{} },
+		newList: func() interface{} { return &[]models.DbAlertRule{} },
+	},
+	"tagrules": {
+		newRule: func() validatedRule { return &models.DbTagRule{} },
+		newList: func() interface{} { return &[]models.DbTagRule{} },
+	},
+	"notifyrules": {
+		newRule: func() validatedRule { return &models.DbNotifyRule{} },
+		newList: func() interface{} { return &[]models.DbNotifyRule{} },
+	},
+	"correlationrules": {
+		newRule: func() validatedRule { return &models.DbAlertGroup{} },
+		newList: func() interface{} { return &[]models.DbAlertGroup{} },
+	},
+	"holidaycalendars": {
+		newRule: func() validatedRule { return &models.HolidayCalendar{} },
+		newList: func() interface{} { return &[]models.HolidayCalendar{} },
+	},
+	lookupTableCollection: {
+		newRule: func() validatedRule { return &models.LookupTable{} },
+		newList: func() interface{} { return &[]models.LookupTable{} },
+	},
+	runbookCollection: {
+		newRule: func() validatedRule { return &models.Runbook{} },
+		newList: func() interface{} { return &[]models.Runbook{} },
+	},
+}
+
+// RulesHandler serves /api/v1/rules/{kind}: GET lists the rules of a
+// collection, POST validates and creates one.
+func RulesHandler(w http.ResponseWriter, r *http.Request, mongoClient *mongo.Client) {
+	kindName := r.PathValue("kind")
+	kind, ok := ruleKinds[kindName]
+	if !ok {
+		http.Error(w, fmt.Sprintf("Unknown rule collection %q", kindName), http.StatusNotFound)
+		return
+	}
+	collection := mongoClient.Database(mongodatabase).Collection(kindName)
+
+	switch r.Method {
+	case http.MethodGet:
+		rules := kind.newList()
+		sort := bson.D{{Key: "order", Value: 1}, {Key: "_id", Value: 1}}
+		if kindName == "correlationrules" {
+			sort = bson.D{{Key: "groupwindow", Value: 1}, {Key: "_id", Value: 1}}
+		}
+		if err := findAll(context.TODO(), collection, sort, rules); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(rules)
+
+	case http.MethodPost:
+		rule, err := decodeRule(r, kind.newRule())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		setRuleField(rule, "ID", primitive.NewObjectID())
+		setRuleField(rule, "Revision", 1)
+		if _, err := collection.InsertOne(context.TODO(), rule); err != nil {
+			http.Error(w, fmt.Sprintf("Error saving rule: %v", err), http.StatusInternalServerError)
+			return
+		}
+		recordWrittenRevision(context.TODO(), mongoClient, kindName, rule, models.RevisionActionCreate, ruleAuthor(r))
+		reloadAfterRuleChange(mongoClient, "create on "+kindName)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(rule)
+
+	default:
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+	}
+}
+
+// RuleHandler serves /api/v1/rules/{kind}/{id}: GET returns the rule, PUT
+// validates and replaces it, DELETE removes it.
+func RuleHandler(w http.ResponseWriter, r *http.Request, mongoClient *mongo.Client) {
+	kindName := r.PathValue("kind")
+	kind, ok := ruleKinds[kindName]
+	if !ok {
+		http.Error(w, fmt.Sprintf("Unknown rule collection %q", kindName), http.StatusNotFound)
+		return
+	}
+	id, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid rule id", http.StatusBadRequest)
+		return
+	}
+	collection := mongoClient.Database(mongodatabase).Collection(kindName)
+	filter := bson.M{"_id": id}
+
+	switch r.Method {
+	case http.MethodGet:
+		rule := kind.newRule()
+		err := collection.FindOne(context.TODO(), filter).Decode(rule)
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Rule not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(rule)
+
+	case http.MethodPut:
+		rule, err := decodeRule(r, kind.newRule())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := replaceRule(context.TODO(), mongoClient, kindName, id, rule, models.RevisionActionUpdate, ruleAuthor(r)); err != nil {
+			http.Error(w, err.Error(), ruleWriteStatus(err))
+			return
+		}
+		reloadAfterRuleChange(mongoClient, "update on "+kindName)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(rule)
+
+	case http.MethodDelete:
+		if err := deleteRule(context.TODO(), mongoClient, kindName, id, kind.newRule(), ruleAuthor(r)); err != nil {
+			http.Error(w, err.Error(), ruleWriteStatus(err))
+			return
+		}
+		reloadAfterRuleChange(mongoClient, "delete on "+kindName)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+	}
+}
+
+// decodeRule reads the request body into rule and validates it.
+func decodeRule(r *http.Request, rule validatedRule) (validatedRule, error) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading request body")
+	}
+	if err := json.Unmarshal(body, rule); err != nil {
+		return nil, fmt.Errorf("Error parsing JSON: %v", err)
+	}
+	if err := rule.Validate(); err != nil {
+		return nil, fmt.Errorf("Invalid rule: %v", err)
+	}
+	return rule, nil
+}
+
+// setRuleField sets one of the fields shared by all rule models (ID,
+// Revision), so values in request bodies never override the server's.
+func setRuleField(rule validatedRule, name string, value interface{}) {
+	field := reflect.ValueOf(rule).Elem().FieldByName(name)
+	if field.IsValid() && field.CanSet() {
+		field.Set(reflect.ValueOf(value))
+	}
+}
+
+// ruleField reads one of the fields shared by all rule models.
+func ruleField(rule validatedRule, name string) interface{} {
+	field := reflect.ValueOf(rule).Elem().FieldByName(name)
+	if !field.IsValid() {
+		return nil
+	}
+	return field.Interface()
+}
+
+// reloadAfterRuleChange makes API edits effective immediately rather than on
+// the next change stream event or timer tick.
+func reloadAfterRuleChange(mongoClient *mongo.Client, reason string) {
+	if _, err := ReloadRules(mongoClient, reason); err != nil {
+		fmt.Println("Error reloading rules:", err)
+	}
+}
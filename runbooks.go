@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"alertmanager/models"
+	"alertmanager/utilities"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// runbookCollection holds the runbook registry, managed through the rules
+// API at /api/v1/rules/runbooks.
+const runbookCollection = "runbooks"
+
+// attachRunbooks sets the runbooks whose conditions match the alert, in
+// runbook order. A runbook whose URL or instructions fail to render, or whose
+// URL renders to anything but an http or https URL, is skipped and counted as
+// a rule error.
+func attachRunbooks(newAlert *models.DbAlert, mongoClient *mongo.Client) {
+	rules := currentRules(mongoClient)
+	if len(rules.Runbooks) == 0 {
+		return
+	}
+	alertMap, err := alertToMap(newAlert)
+	if err != nil {
+		fmt.Println("ERROR : Unable to convert struct to map")
+		return
+	}
+
+	for _, compiled := range rules.Runbooks {
+		runbook := compiled.Runbook
+		if !evaluateRule("runbook", runbook.ID, runbook.Name, alertMap, compiled.Group) {
+			continue
+		}
+		link, err := utilities.RenderTemplate(runbook.URL, newAlert)
+		if err == nil && runbook.URL != "" {
+			// Alert fields used by the template may yield anything.
+			err = models.CheckRunbookURL(link)
+		}
+		if err == nil {
+			var instructions string
+			if instructions, err = utilities.RenderTemplate(runbook.Instructions, newAlert); err == nil {
+				newAlert.Runbooks = append(newAlert.Runbooks, models.AlertRunbook{
+					RunbookID:    runbook.ID,
+					Name:         runbook.Name,
+					URL:          link,
+					Instructions: instructions,
+				})
+				continue
+			}
+		}
+		fmt.Printf("ERROR : runbook %s failed to render: %v\n", runbook.Name, err)
+		recordRuleError("runbook", runbook.Name, err)
+	}
+}
+
+// AlertHandler returns one alert, live or archived, with its runbooks.
+func AlertHandler(w http.ResponseWriter, r *http.Request, mongoClient *mongo.Client) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	id, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid alert id", http.StatusBadRequest)
+		return
+	}
+
+	collections, err := alertQueryCollections(mongoClient, "include")
+	if err != nil {
+		// File mode archives are not queryable, look at live alerts only.
+		collections, _ = alertQueryCollections(mongoClient, "")
+	}
+	for _, collection := range collections {
+		var alert models.DbAlert
+		err := collection.FindOne(context.TODO(), bson.M{"_id": id}).Decode(&alert)
+		if err == mongo.ErrNoDocuments {
+			continue
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(alert)
+		return
+	}
+	http.Error(w, "Alert not found", http.StatusNotFound)
+}
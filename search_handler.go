@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"alertmanager/models"
+	"alertmanager/utilities"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const alertTextIndexName = "alert_text_search"
+
+type SearchResult struct {
+	Score      float64           `json:"score"`
+	Archived   bool              `json:"archived,omitempty"`
+	Alert      models.DbAlert    `json:"alert"`
+	Highlights map[string]string `json:"highlights"`
+}
+
+type SearchResponse struct {
+	Query   string         `json:"query"`
+	Total   int64          `json:"total"`
+	Results []SearchResult `json:"results"`
+}
+
+// searchHit is the decoded Mongo document with the textScore projected in.
+type searchHit struct {
+	models.DbAlert `bson:",inline"`
+	Score          float64 `bson:"score"`
+}
+
+// EnsureSearchIndexes creates the text index used by the search endpoint.
+// A wildcard text index is used so tag values in additionaldetails are
+// searchable as well, with the main alert fields weighted higher.
+func EnsureSearchIndexes(collection *mongo.Collection) error {
+	index := mongo.IndexModel{
+		Keys: bson.D{{Key: "$**", Value: "text"}},
+		Options: options.Index().
+			SetName(alertTextIndexName).
+			SetWeights(bson.D{
+				{Key: "alertsummary", Value: 10},
+				{Key: "entity", Value: 8},
+				{Key: "servicename", Value: 5},
+				{Key: "alertnotes", Value: 3},
+			}),
+	}
+	_, err := collection.Indexes().CreateOne(context.TODO(), index)
+	return err
+}
+
+func AlertSearchHandler(w http.ResponseWriter, r *http.Request, mongoClient *mongo.Client) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx := context.TODO()
+
+	rawQuery := r.URL.Query().Get("q")
+	query := utilities.ParseSearchQuery(rawQuery)
+	if query.IsEmpty() {
+		http.Error(w, "Query parameter 'q' is required", http.StatusBadRequest)
+		return
+	}
+
+	collections, err := alertQueryCollections(mongoClient, r.URL.Query().Get("archive"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	filter := searchFilter(query)
+	if status := r.URL.Query().Get("status"); status != "" {
+		filter["alertstatus"] = strings.ToUpper(status)
+	}
+	_, textSearch := filter["$text"]
+
+	limit := int64(50)
+	if val, err := strconv.ParseInt(r.URL.Query().Get("limit"), 10, 64); err == nil && val > 0 && val <= 500 {
+		limit = val
+	}
+	skip := int64(0)
+	if val, err := strconv.ParseInt(r.URL.Query().Get("skip"), 10, 64); err == nil && val > 0 {
+		skip = val
+	}
+
+	// Each collection returns its first skip+limit hits, the merged list is
+	// then ranked and paged as a whole.
+	findOptions := options.Find().SetLimit(skip + limit)
+	if textSearch {
+		findOptions.SetProjection(bson.M{"score": bson.M{"$meta": "textScore"}})
+		findOptions.SetSort(bson.D{{Key: "score", Value: bson.M{"$meta": "textScore"}}})
+	} else {
+		findOptions.SetSort(bson.D{{Key: "alertlasttime.time", Value: -1}})
+	}
+
+	var total int64
+	results := []SearchResult{}
+	for _, collection := range collections {
+		archived := collection.Name() != mongocollection
+
+		count, err := collection.CountDocuments(ctx, filter)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		total += count
+
+		cursor, err := collection.Find(ctx, filter, findOptions)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		var hits []searchHit
+		err = cursor.All(ctx, &hits)
+		cursor.Close(ctx)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		for _, hit := range hits {
+			results = append(results, SearchResult{
+				Score:      hit.Score,
+				Archived:   archived,
+				Alert:      hit.DbAlert,
+				Highlights: highlightAlert(query, hit.DbAlert),
+			})
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		if textSearch {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Alert.AlertLastTime.After(results[j].Alert.AlertLastTime.Time)
+	})
+	if skip >= int64(len(results)) {
+		results = []SearchResult{}
+	} else {
+		results = results[skip:]
+	}
+	if int64(len(results)) > limit {
+		results = results[:limit]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(SearchResponse{
+		Query:   rawQuery,
+		Total:   total,
+		Results: results,
+	})
+}
+
+// searchFilter turns a parsed query into a Mongo filter. Free text goes to
+// the text index, field scoped terms become case-insensitive exact matches on
+// either the top level field or the additionaldetails tag of that name.
+func searchFilter(query utilities.SearchQuery) bson.M {
+	filter := bson.M{}
+
+	if text := query.TextSearch(); text != "" {
+		filter["$text"] = bson.M{"$search": text}
+	}
+
+	for field, value := range query.Fields {
+		match := bson.M{"$regex": "^" + regexp.QuoteMeta(value) + "$", "$options": "i"}
+		switch {
+		case isTopLevel(field):
+			filter[field] = match
+		case strings.HasPrefix(field, "additionaldetails."):
+			filter[field] = match
+		default:
+			filter["additionaldetails."+field] = match
+		}
+	}
+	return filter
+}
+
+// highlightAlert returns the searchable fields of the alert that contain a
+// match, with the matched terms wrapped in <em></em>.
+func highlightAlert(query utilities.SearchQuery, alert models.DbAlert) map[string]string {
+	highlights := make(map[string]string)
+
+	fields := map[string]string{
+		"entity":       alert.Entity,
+		"servicename":  alert.ServiceName,
+		"alertsummary": alert.AlertSummary,
+		"alertnotes":   alert.AlertNotes,
+	}
+	for name, value := range fields {
+		if marked, ok := query.Highlight(name, value); ok {
+			highlights[name] = marked
+		}
+	}
+
+	for key, value := range alert.AdditionalDetails {
+		if value == nil {
+			continue
+		}
+		name := "additionaldetails." + key
+		if marked, ok := query.Highlight(name, fmt.Sprintf("%v", value)); ok {
+			highlights[name] = marked
+		}
+	}
+	return highlights
+}
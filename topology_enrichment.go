@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"alertmanager/models"
+	"alertmanager/utilities"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// Topology enrichment settings:
+//
+//	TOPOLOGY_ENRICHMENT      "false" disables the lookups
+//	TOPOLOGY_TIMEOUT_MS      time allowed for one lookup (default 500)
+//	TOPOLOGY_CACHE_SECONDS   how long a lookup result is reused (default 300)
+//	TOPOLOGY_BACKOFF_SECONDS how long lookups are skipped after Neo4j failed (default 30)
+//	TOPOLOGY_ENTITY_LABEL    label of entity nodes, matched on an indexed name property (default Entity)
+var (
+	topologyEnrichment       = envString("TOPOLOGY_ENRICHMENT", "true") != "false"
+	topologyTimeout          = time.Duration(envInt("TOPOLOGY_TIMEOUT_MS", 500)) * time.Millisecond
+	topologyCacheTTL         = time.Duration(envInt("TOPOLOGY_CACHE_SECONDS", 300)) * time.Second
+	topologyBackoff          = time.Duration(envInt("TOPOLOGY_BACKOFF_SECONDS", 30)) * time.Second
+	topologyCacheMutex       sync.Mutex
+	topologyCache            = make(map[string]topologyCacheEntry)
+	topologyUnavailableUntil time.Time
+	topologyEntityLabel      = envString("TOPOLOGY_ENTITY_LABEL", "Entity")
+	// topologyTimeouts counts consecutive lookup timeouts per entity.
+	topologyTimeouts = make(map[string]int)
+)
+
+// topologyMaxTimeouts is how many lookups of one entity may time out in a row
+// before the entity is skipped for TOPOLOGY_CACHE_SECONDS.
+const topologyMaxTimeouts = 3
+
+// topologyCacheMax bounds the cache; it is cleared when full.
+const topologyCacheMax = 10000
+
+type topologyCacheEntry struct {
+	info    *utilities.TopologyInfo // nil when the entity is not in the graph
+	expires time.Time
+}
+
+// enrichFromTopology adds the tier, labels, host, rack, datacenter and
+// application of the alert's entity to AdditionalDetails, without replacing
+// tags the source already sent. Alert processing never waits on Neo4j for
+// longer than TOPOLOGY_TIMEOUT_MS. After a connectivity or driver failure
+// lookups are skipped for TOPOLOGY_BACKOFF_SECONDS so an outage does not slow
+// down every alert; a timeout only counts against the entity that was looked
+// up, so one expensive entity cannot turn enrichment off for all others.
+func enrichFromTopology(alert *models.DbAlert, driver neo4j.DriverWithContext) {
+	if !topologyEnrichment || driver == nil || alert.Entity == "" {
+		return
+	}
+
+	info, ok := cachedTopology(alert.Entity)
+	if !ok {
+		topologyCacheMutex.Lock()
+		unavailable := time.Now().Before(topologyUnavailableUntil)
+		topologyCacheMutex.Unlock()
+		if unavailable {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), topologyTimeout)
+		defer cancel()
+		var err error
+		info, err = utilities.LookupTopology(ctx, driver, topologyEntityLabel, alert.Entity)
+
+		topologyCacheMutex.Lock()
+		switch {
+		case err == nil:
+			delete(topologyTimeouts, alert.Entity)
+			cacheTopology(alert.Entity, info)
+			topologyCacheMutex.Unlock()
+		case ctx.Err() != nil:
+			topologyTimeouts[alert.Entity]++
+			timeouts := topologyTimeouts[alert.Entity]
+			if timeouts >= topologyMaxTimeouts {
+				delete(topologyTimeouts, alert.Entity)
+				cacheTopology(alert.Entity, nil)
+			}
+			topologyCacheMutex.Unlock()
+			fmt.Printf("Topology lookup for %s timed out (%d in a row)\n", alert.Entity, timeouts)
+			return
+		case neo4j.IsNeo4jError(err) || neo4j.IsUsageError(err):
+			// The query failed for this entity, Neo4j itself is reachable.
+			topologyCacheMutex.Unlock()
+			fmt.Printf("Topology lookup for %s failed: %v\n", alert.Entity, err)
+			return
+		default:
+			topologyUnavailableUntil = time.Now().Add(topologyBackoff)
+			topologyCacheMutex.Unlock()
+			fmt.Printf("Topology lookup for %s failed, skipping lookups for %v: %v\n", alert.Entity, topologyBackoff, err)
+			return
+		}
+	}
+	if info == nil {
+		return
+	}
+
+	if alert.AdditionalDetails == nil {
+		alert.AdditionalDetails = make(map[string]interface{})
+	}
+	tags := map[string]string{
+		"tier":        info.Tier,
+		"labels":      strings.Join(info.Labels, ","),
+		"host":        info.Host,
+		"rack":        info.Rack,
+		"datacenter":  info.Datacenter,
+		"application": info.Application,
+	}
+	for name, value := range tags {
+		if _, exists := alert.AdditionalDetails[name]; !exists && value != "" {
+			alert.AdditionalDetails[name] = value
+		}
+	}
+}
+
+// cacheTopology stores a lookup result; the caller holds topologyCacheMutex.
+func cacheTopology(entity string, info *utilities.TopologyInfo) {
+	if len(topologyCache) >= topologyCacheMax {
+		topologyCache = make(map[string]topologyCacheEntry)
+		topologyTimeouts = make(map[string]int)
+	}
+	topologyCache[entity] = topologyCacheEntry{info: info, expires: time.Now().Add(topologyCacheTTL)}
+}
+
+func cachedTopology(entity string) (*utilities.TopologyInfo, bool) {
+	topologyCacheMutex.Lock()
+	defer topologyCacheMutex.Unlock()
+
+	entry, ok := topologyCache[entity]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(entry.expires) {
+		delete(topologyCache, entity)
+		return nil, false
+	}
+	return entry.info, true
+}
@@ -24,7 +24,25 @@ func PriorityToInt(p string) int {
 	return 4
 }
 
+// IsPriority reports whether p is one of the priorities P0 to P4.
+func IsPriority(p string) bool {
+	return len(p) == 2 && p[0] == 'P' && p[1] >= '0' && p[1] <= '4'
+}
+
 // IntToPriority converts an integer to a priority string (e.g., 1 -> "P1").
 func IntToPriority(i int) string {
 	return "P" + strconv.Itoa(i)
 }
+
+// ShiftPriority moves a priority by steps, negative steps raising it (towards
+// P0) and positive steps lowering it (towards P4), clamped to P0..P4.
+func ShiftPriority(p string, steps int) string {
+	shifted := PriorityToInt(p) + steps
+	if shifted < 0 {
+		shifted = 0
+	}
+	if shifted > 4 {
+		shifted = 4
+	}
+	return IntToPriority(shifted)
+}
@@ -0,0 +1,136 @@
+package utilities
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// SearchQuery is the parsed form of an operator search string such as
+// `disk full "write latency" servicename:payments`.
+type SearchQuery struct {
+	Terms   []string          // free text words, passed to the Mongo $text search
+	Phrases []string          // quoted phrases, matched exactly by $text
+	Fields  map[string]string // field scoped filters, e.g. servicename -> payments
+}
+
+// ParseSearchQuery splits a search string into free text terms, quoted phrases
+// and field:value filters. Field values may themselves be quoted.
+func ParseSearchQuery(q string) SearchQuery {
+	query := SearchQuery{Fields: make(map[string]string)}
+
+	for _, token := range tokenizeSearch(q) {
+		if idx := strings.Index(token, ":"); idx > 0 && idx < len(token)-1 && !strings.HasPrefix(token, `"`) {
+			field := strings.ToLower(token[:idx])
+			query.Fields[field] = strings.Trim(token[idx+1:], `"`)
+			continue
+		}
+		if strings.HasPrefix(token, `"`) {
+			phrase := strings.TrimSpace(strings.Trim(token, `"`))
+			if phrase != "" {
+				query.Phrases = append(query.Phrases, phrase)
+			}
+			continue
+		}
+		query.Terms = append(query.Terms, token)
+	}
+	return query
+}
+
+// IsEmpty reports whether the query contains nothing to search for.
+func (q SearchQuery) IsEmpty() bool {
+	return len(q.Terms) == 0 && len(q.Phrases) == 0 && len(q.Fields) == 0
+}
+
+// TextSearch builds the $search string for a Mongo $text query. Phrases are
+// re-quoted so Mongo treats them as exact phrase matches.
+func (q SearchQuery) TextSearch() string {
+	parts := make([]string, 0, len(q.Terms)+len(q.Phrases))
+	parts = append(parts, q.Terms...)
+	for _, phrase := range q.Phrases {
+		parts = append(parts, fmt.Sprintf("%q", phrase))
+	}
+	return strings.Join(parts, " ")
+}
+
+// Highlight wraps every occurrence of the query terms and phrases in text with
+// <em></em>. Terms also match longer words so that stemmed matches returned
+// by Mongo (payment -> payments) are highlighted too. Field scoped values are
+// only highlighted in the field they name; field is the stored path of text,
+// e.g. alertsummary or additionaldetails.region.
+// Alert text comes from ingestion, so it is HTML escaped before the tags are
+// inserted and the result is safe to render as HTML.
+// The second return value is false when nothing in text matched.
+func (q SearchQuery) Highlight(field, text string) (string, bool) {
+	escaped := html.EscapeString(text)
+	if text == "" {
+		return escaped, false
+	}
+	patterns := make([]string, 0, len(q.Terms)+len(q.Phrases))
+	for _, phrase := range q.Phrases {
+		patterns = append(patterns, regexp.QuoteMeta(html.EscapeString(phrase)))
+	}
+	for _, term := range q.Terms {
+		patterns = append(patterns, `\b`+regexp.QuoteMeta(html.EscapeString(term))+`\w*`)
+	}
+	for name, value := range q.Fields {
+		if name == field || "additionaldetails."+name == field {
+			patterns = append(patterns, regexp.QuoteMeta(html.EscapeString(value)))
+		}
+	}
+	if len(patterns) == 0 {
+		return escaped, false
+	}
+
+	// Entities added by escaping are matched as a whole after the patterns,
+	// so a term such as "amp" is never highlighted inside "&amp;".
+	re, err := regexp.Compile(`(?i)(` + strings.Join(patterns, "|") + `)|&#?\w+;`)
+	if err != nil {
+		return escaped, false
+	}
+
+	var out strings.Builder
+	last, matched := 0, false
+	for _, loc := range re.FindAllStringSubmatchIndex(escaped, -1) {
+		if loc[2] < 0 {
+			continue
+		}
+		out.WriteString(escaped[last:loc[2]])
+		out.WriteString("<em>" + escaped[loc[2]:loc[3]] + "</em>")
+		last, matched = loc[3], true
+	}
+	if !matched {
+		return escaped, false
+	}
+	out.WriteString(escaped[last:])
+	return out.String(), true
+}
+
+// tokenizeSearch splits on whitespace while keeping quoted sections (including
+// field:"quoted value") together.
+func tokenizeSearch(q string) []string {
+	var tokens []string
+	var current strings.Builder
+	inQuotes := false
+
+	for _, r := range q {
+		switch {
+		case r == '"':
+			inQuotes = !inQuotes
+			current.WriteRune(r)
+		case unicode.IsSpace(r) && !inQuotes:
+			if current.Len() > 0 {
+				tokens = append(tokens, current.String())
+				current.Reset()
+			}
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if current.Len() > 0 {
+		tokens = append(tokens, current.String())
+	}
+	return tokens
+}
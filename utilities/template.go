@@ -0,0 +1,122 @@
+package utilities
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+var templateCache sync.Map
+
+// templateFuncs are available in every rule value template, e.g.
+// {{lower .ServiceName}} or {{.AdditionalDetails.region | trim | upper}}.
+var templateFuncs = template.FuncMap{
+	"lower": func(v interface{}) string { return strings.ToLower(templateString(v)) },
+	"upper": func(v interface{}) string { return strings.ToUpper(templateString(v)) },
+	"trim":  func(v interface{}) string { return strings.TrimSpace(templateString(v)) },
+	// placeholder stands in for ${path} placeholders, see RenderValue.
+	"placeholder": func(path string) (interface{}, error) {
+		return nil, fmt.Errorf("placeholder %s used outside RenderValue", path)
+	},
+}
+
+// ErrMissingValue is returned by RenderValue when the value references a tag
+// or field the data does not have.
+var ErrMissingValue = errors.New("missing value")
+
+// placeholderPattern matches ${path} placeholders.
+var placeholderPattern = regexp.MustCompile(`\$\{([^}]+)\}`)
+
+func templateString(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+// IsTemplate reports whether a rule value contains template actions and has
+// to be rendered before use.
+func IsTemplate(text string) bool {
+	return strings.Contains(text, "{{")
+}
+
+// ParseTemplate compiles a rule value template, reusing earlier compilations
+// of the same text.
+func ParseTemplate(text string) (*template.Template, error) {
+	if tmpl, ok := templateCache.Load(text); ok {
+		return tmpl.(*template.Template), nil
+	}
+	tmpl, err := template.New("value").Funcs(templateFuncs).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	templateCache.Store(text, tmpl)
+	return tmpl, nil
+}
+
+// RenderTemplate renders a rule value such as "{{.Entity}} in
+// {{.AdditionalDetails.region}}" against data, normally a DbAlert. Values
+// without template actions are returned unchanged and missing keys render as
+// empty strings.
+func RenderTemplate(text string, data interface{}) (string, error) {
+	if !IsTemplate(text) {
+		return text, nil
+	}
+	tmpl, err := ParseTemplate(text)
+	if err != nil {
+		return "", err
+	}
+	var out strings.Builder
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", err
+	}
+	// missingkey=zero still prints "<no value>" for absent keys of
+	// map[string]interface{}, as used by AdditionalDetails.
+	return strings.ReplaceAll(out.String(), "<no value>", ""), nil
+}
+
+// RenderValue renders a tag value that may mix template actions and ${path}
+// placeholders, e.g. "{{lower .ServiceName}}-${region}". Placeholders are
+// resolved with resolve while the template runs, so alert content is never
+// expanded a second time. Unlike RenderTemplate, a missing key or an empty or
+// unresolved placeholder does not render as empty: ErrMissingValue is
+// returned instead.
+func RenderValue(text string, data interface{}, resolve func(path string) (interface{}, bool)) (string, error) {
+	source := placeholderPattern.ReplaceAllStringFunc(text, func(placeholder string) string {
+		path := strings.TrimSpace(placeholder[2 : len(placeholder)-1])
+		return "{{placeholder " + strconv.Quote(path) + "}}"
+	})
+	if !IsTemplate(source) {
+		return source, nil
+	}
+	tmpl, err := ParseTemplate(source)
+	if err != nil {
+		return "", err
+	}
+	tmpl, err = tmpl.Clone()
+	if err != nil {
+		return "", err
+	}
+	tmpl.Option("missingkey=error").Funcs(template.FuncMap{
+		"placeholder": func(path string) (interface{}, error) {
+			if value, ok := resolve(path); ok && templateString(value) != "" {
+				return value, nil
+			}
+			return nil, fmt.Errorf("%w: %s", ErrMissingValue, path)
+		},
+	})
+
+	var out strings.Builder
+	if err := tmpl.Execute(&out, data); err != nil {
+		// text/template reports missing map keys only by message.
+		if strings.Contains(err.Error(), "map has no entry for key") {
+			return "", fmt.Errorf("%w: %v", ErrMissingValue, err)
+		}
+		return "", err
+	}
+	return out.String(), nil
+}
@@ -0,0 +1,99 @@
+package utilities
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// TopologyInfo is what the topology graph knows about an entity.
+type TopologyInfo struct {
+	Tier        string
+	Labels      []string
+	Host        string
+	Rack        string
+	Datacenter  string
+	Application string
+}
+
+// topologyQuery finds the entity by the name property of nodes with the
+// given label (%s), which should be indexed, and the nearest Host, Rack,
+// Datacenter and Application nodes around it. The entity itself counts, so a
+// host's own name is returned as its host.
+const topologyQuery = `
+MATCH (n:%s)
+WHERE n.name IN [$name, $full]
+WITH n LIMIT 1
+CALL { WITH n OPTIONAL MATCH p = (n)-[*0..3]-(x:Host) RETURN coalesce(x.name, x.id) AS host ORDER BY length(p) LIMIT 1 }
+CALL { WITH n OPTIONAL MATCH p = (n)-[*0..4]-(x:Rack) RETURN coalesce(x.name, x.id) AS rack ORDER BY length(p) LIMIT 1 }
+CALL { WITH n OPTIONAL MATCH p = (n)-[*0..5]-(x:Datacenter) RETURN coalesce(x.name, x.id) AS datacenter ORDER BY length(p) LIMIT 1 }
+CALL { WITH n OPTIONAL MATCH p = (n)-[*0..3]-(x:Application) RETURN coalesce(x.name, x.id) AS application ORDER BY length(p) LIMIT 1 }
+RETURN n.tier AS tier, labels(n) AS labels, host, rack, datacenter, application
+`
+
+// topologyLabel restricts labels to plain identifiers, as they cannot be
+// passed as query parameters.
+var topologyLabel = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// LookupTopology returns the topology of an entity, or nil when the entity
+// is not in the graph. Entities are nodes with the given label and may be
+// given as "type:name".
+func LookupTopology(ctx context.Context, driver neo4j.DriverWithContext, label string, entity string) (*TopologyInfo, error) {
+	if !topologyLabel.MatchString(label) {
+		return nil, fmt.Errorf("invalid topology label %q", label)
+	}
+	query := fmt.Sprintf(topologyQuery, label)
+
+	searchTerm := entity
+	if parts := strings.SplitN(entity, ":", 2); len(parts) == 2 {
+		searchTerm = parts[1]
+	}
+
+	session := driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeRead})
+	defer session.Close(ctx)
+
+	result, err := session.ExecuteRead(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		result, err := tx.Run(ctx, query, map[string]any{
+			"name": searchTerm,
+			"full": entity,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if !result.Next(ctx) {
+			return nil, result.Err()
+		}
+		record := result.Record()
+
+		info := &TopologyInfo{Labels: []string{}}
+		info.Tier = recordString(record, "tier")
+		info.Host = recordString(record, "host")
+		info.Rack = recordString(record, "rack")
+		info.Datacenter = recordString(record, "datacenter")
+		info.Application = recordString(record, "application")
+		labelsRaw, _ := record.Get("labels")
+		if val, ok := labelsRaw.([]interface{}); ok {
+			for _, v := range val {
+				if s, ok := v.(string); ok {
+					info.Labels = append(info.Labels, s)
+				}
+			}
+		}
+		return info, nil
+	})
+	if err != nil || result == nil {
+		return nil, err
+	}
+	return result.(*TopologyInfo), nil
+}
+
+func recordString(record *neo4j.Record, key string) string {
+	value, _ := record.Get(key)
+	if value == nil {
+		return ""
+	}
+	return fmt.Sprintf("%v", value)
+}